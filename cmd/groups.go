@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"indy-mqtt/internal/config"
+	"indy-mqtt/internal/util"
+)
+
+// printGroups prints each group in `cfg`, including the built-in
+// config.ALL_GROUP unless it's redefined, its members as configured, and the
+// devices they resolve to.
+func printGroups(cfg *config.Config) {
+	// Add the built-in group
+	names := cfg.Groups.Names()
+	_, isRedefined := cfg.Groups[config.ALL_GROUP]
+	if !isRedefined {
+		names = append(names, config.ALL_GROUP)
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		devices, err := cfg.ResolveGroup(name)
+		if err != nil {
+			util.ERROR.Printf("Unable to resolve group '%s': %v", name, err)
+			continue
+		}
+		ids := make([]string, len(devices))
+		for i, device := range devices {
+			ids[i] = device.ID
+		}
+		members, ok := cfg.Groups[name]
+		if ok {
+			fmt.Printf("%s: %s\n", name, strings.Join(members, ", "))
+		} else {
+			fmt.Printf("%s: (built-in, every device in the inventory)\n", name)
+		}
+		fmt.Printf("  resolves to: %s\n", strings.Join(ids, ", "))
+	}
+}
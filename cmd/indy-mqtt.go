@@ -10,6 +10,9 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,6 +21,7 @@ import (
 	"indy-mqtt/internal/command"
 	"indy-mqtt/internal/config"
 	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/output"
 	"indy-mqtt/internal/util"
 )
 
@@ -26,18 +30,29 @@ var version string
 
 var connectionLost bool = false
 
-const TIMEOUT = 30 * time.Second
-
 func main() {
 	// Parse command line
 	binaryName := filepath.Base(os.Args[0])
-	args := parseCommandLine(binaryName)
+	options, args := parseCommandLine(binaryName)
 
 	// Configure logging
 	util.ConfigureLogging()
 
+	// Print suntimes
+	if len(args) > 0 && args[0] == "suntimes" {
+		printSuntimes(args[1:])
+		return
+	}
+
+	// Print timezone
+	if len(args) > 0 && args[0] == "timezone" {
+		printTimezone(args[1:])
+		return
+	}
+
 	// Read config file
-	config := config.LoadConfig()
+	config := config.LoadConfig(options.configPath, options.profile)
+	options.applyTimeouts(config)
 
 	// Lookup hostname
 	hostname, err := os.Hostname()
@@ -48,98 +63,96 @@ func main() {
 	// Generate client ID
 	clientID := fmt.Sprintf("%s-%s", hostname, binaryName)
 
-	// Create command
-	cmd, err := command.NewCommand(clientID, args)
+	// List groups
+	if len(args) > 0 && args[0] == "groups" {
+		if len(args) > 1 {
+			util.PrintFatalUsage("unexpected arguments for groups command")
+		}
+		printGroups(config)
+		return
+	}
+
+	// Watch topics
+	if len(args) > 1 && args[1] == "watch" {
+		runWatch(config, clientID, args[0], args[2:], options.format)
+		return
+	}
+
+	// Create commands
+	cmds, err := command.NewCommand(clientID, args, config)
 	if err != nil {
-		util.PrintFatalUsage(err.Error())
+		util.PrintFatalError(err)
+	}
+	if len(cmds) == 0 {
+		util.PrintFatalUsage("no devices to send the command to")
+	}
+	statusHandler, isStatus := cmds[0].AckHandler.(command.GetStatusAckHandler)
+	isTable := isStatus && statusHandler.Table
+	if isStatus && (statusHandler.Template != nil || isTable) && options.format.IsStructured() {
+		util.PrintFatalUsage("status --format and --table can't be used with -output " + string(options.format))
+	}
+	hosts := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		hosts[i] = cmd.Host
+		if cmd.Device.Location != "" {
+			util.INFO.Printf("Device '%s' is located at '%s'", cmd.Host, cmd.Device.Location)
+		}
 	}
 
 	// Connect to MQTT broker
+	config.ResolvePassword()
 	ackCh := make(chan message.AckMessage)
-	client, err := connect(config, clientID, cmd.IsAckExpected, cmd.Host, ackCh)
-	if err != nil {
-		util.ERROR.Fatalf("Unable to connect: %v", err)
+	var topics map[string]byte
+	if cmds[0].IsAckExpected {
+		topics = ackSubscriptions(hosts)
 	}
-
-	// Publish message
-	var messageBytes []byte
-	messageBytes, err = json.Marshal(cmd.Message)
+	client, err := connect(config, clientID, topics, newAckHandler(ackCh))
 	if err != nil {
-		util.ERROR.Fatalf("Error marshaling message: %v", err)
-	}
-	if util.Verbose {
-		util.INFO.Printf("Publishing to topic '%s'", cmd.Topic)
-		prettyJSON := marshalToJSONString(cmd.Message)
-		util.INFO.Printf("Message:\n%s", prettyJSON)
+		util.FatalExitf(util.EXIT_CONNECT, "Unable to connect: %v", err)
 	}
-	token := client.Publish(cmd.Topic, cmd.QOS, false, messageBytes)
 
 	// Create a channel to listen for interrupt signal
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
-	defer close(interrupt)
-
-	// Wait for the publish to complete, or an interrupt signal
-	publishSuccess := false
-	select {
-	case <-token.Done():
-		if token.Error() != nil {
-			util.ERROR.Printf("Failed to publish: %v", token.Error())
-		} else {
-			util.INFO.Printf("Message published successfully")
-			publishSuccess = true
-		}
-	case <-interrupt:
-		fmt.Println("Interrupt signal received. Exiting...")
-	}
-
-	// Watch for ack
-	if cmd.IsAckExpected && publishSuccess {
-		acked := make(chan struct{})
-		go func() {
-			for ack := range ackCh {
-				// Is this the expected ack?
-				if ack.ID == cmd.Message.Header.MessageID {
-					const STATUS_CODE_OK = 200
-					if ack.StatusCode == STATUS_CODE_OK {
-						util.INFO.Printf("Message was successfully acknowledged")
-
-						// Print ACK message
-						if len(ack.Message) > 0 {
-							fmt.Println(ack.Message)
-						}
-
-						// Handle ACK
-						if err := cmd.HandleAck(ack.Content); err != nil {
-							util.ERROR.Printf("Failed to handle ack: %v", err)
-						}
-					} else {
-						util.ERROR.Printf("ACK error code %d: %s", ack.StatusCode, ack.Message)
-					}
-					close(acked) // Signal that the ack was received
-					return
-				}
-			}
-		}()
 
-		// Watch for ACK or interrupt signal
-		util.INFO.Printf("Watching for ACK")
-		select {
-		case <-acked:
-			// Ack was received
-		case <-time.After(TIMEOUT):
-			util.ERROR.Printf("Timed out while waiting for ACK")
-		case <-interrupt:
-			fmt.Println("Interrupt signal received. Exiting...")
-		}
+	// Run commands
+	runner := newRunner(client, clientID, ackCh, interrupt, config.Timeouts().Ack, options.retries)
+	if isStatus && statusHandler.Every > 0 {
+		runPoll(runner, cmds, clientID, statusHandler.Every, statusHandler.Fields, options.format)
+		disconnect(client)
+		return
 	}
+	results := runner.runCommands(cmds, options.format, isTable)
 
 	// Disconnect from the broker
+	disconnect(client)
+
+	// Report results
+	if isTable {
+		printStatusTable(results)
+	} else if len(results) > 1 && !options.format.IsStructured() {
+		printSummary(results)
+	}
+	os.Exit(exitCode(results))
+}
+
+// disconnect disconnects `client` from the broker.
+func disconnect(client mqtt.Client) {
 	const DISCONNECT_WAIT = 250 // Milliseconds
 	client.Disconnect(DISCONNECT_WAIT)
 	util.INFO.Printf("Disconnected from broker")
 }
 
+// sortedKeys returns the sorted keys of `m`.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // marshalToJSONString returns the JSON encoding for source.
 func marshalToJSONString(source any) string {
 	jsonBytes, err := json.MarshalIndent(source, "", "    ")
@@ -161,64 +174,87 @@ func prettifyJSON(source string) string {
 	return buffer.String()
 }
 
-// connect connects to the MQTT broker.
-func connect(config *config.Config, clientID string, isAckExpected bool, host string, ackCh chan message.AckMessage) (mqtt.Client, error) {
+// ackSubscriptions returns the ACK topics for `hosts`, each mapped to the QOS
+// to subscribe with.
+func ackSubscriptions(hosts []string) map[string]byte {
+	const ACK_QOS = 1
+	topics := make(map[string]byte, len(hosts))
+	for _, host := range hosts {
+		topics[fmt.Sprintf("indy-switch/%s/ack", host)] = ACK_QOS
+	}
+	return topics
+}
+
+// newAckHandler returns a message handler that parses ACKs and forwards them
+// to `ackCh`.
+func newAckHandler(ackCh chan message.AckMessage) mqtt.MessageHandler {
+	return func(_ mqtt.Client, msg mqtt.Message) {
+		// Display JSON received
+		if util.Verbose {
+			prettyJSON := prettifyJSON(string(msg.Payload()))
+			util.INFO.Printf("ACK received:\n%s", prettyJSON)
+		}
+
+		// Unmarshal the ack
+		var ack message.AckMessage
+		err := json.Unmarshal(msg.Payload(), &ack)
+		if err != nil {
+			util.ERROR.Printf("ACK could not be parsed: %v", err)
+			fmt.Fprintf(os.Stderr, "%s\n", msg.Payload())
+			return
+		}
+
+		// Forward ack
+		ackCh <- ack
+	}
+}
+
+// connect connects to the MQTT broker. Each of `topics` is subscribed to with
+// its QOS each time the connection is established, and messages received are
+// passed to `handler`.
+func connect(config *config.Config, clientID string, topics map[string]byte, handler mqtt.MessageHandler) (mqtt.Client, error) {
 	// Prepare connection options
 	options := mqtt.NewClientOptions()
-	brokerUrl := fmt.Sprintf("ssl://%s:%d", *config.Hostname, *config.Port)
+	brokerUrl := config.BrokerURL()
 	options.AddBroker(brokerUrl)
 	options.SetClientID(clientID)
 	options.SetUsername(*config.Username)
 	options.SetPassword(*config.Password)
+	if config.TLS != nil {
+		options.SetTLSConfig(config.TLS)
+	}
+	timeouts := config.Timeouts()
 	options.SetOrderMatters(false) // Allow out of order messages
 	options.ConnectRetry = false   // Don't retry initial connection if connection attempt fails
 	options.AutoReconnect = true   // Reconnect if connection goes down
-	options.PingTimeout = TIMEOUT
-	options.ConnectTimeout = TIMEOUT
-	options.WriteTimeout = TIMEOUT
-	options.KeepAlive = 10 // Seconds. Send keepalive messages frequently to quickly detect network outages.
+	options.PingTimeout = timeouts.Connect
+	options.ConnectTimeout = timeouts.Connect
+	options.WriteTimeout = timeouts.Connect
+	options.SetKeepAlive(timeouts.KeepAlive) // Send keepalive messages frequently to quickly detect network outages.
 
 	// Handle connection events
 	subscribed := make(chan struct{})
-	ackTopic := fmt.Sprintf("indy-switch/%s/ack", host)
+	topicsStr := strings.Join(sortedKeys(topics), "', '")
+	var closeOnce sync.Once
 	options.OnConnect = func(client mqtt.Client) {
 		if connectionLost {
-			fmt.Println("Connection reestablished")
+			fmt.Fprintln(os.Stderr, "Connection reestablished")
 		} else {
 			util.INFO.Printf("Connection established")
 		}
 		connectionLost = false
 
-		// Subscribe to ack topic
-		if isAckExpected {
-			util.INFO.Printf("Subscribing to '%s'", ackTopic)
-			const ACK_QOS = 1
-			token := client.Subscribe(ackTopic, ACK_QOS, func(_ mqtt.Client, msg mqtt.Message) {
-				// Display JSON received
-				if util.Verbose {
-					prettyJSON := prettifyJSON(string(msg.Payload()))
-					util.INFO.Printf("ACK received:\n%s", prettyJSON)
-				}
-
-				// Unmarshal the ack
-				var ack message.AckMessage
-				err := json.Unmarshal(msg.Payload(), &ack)
-				if err != nil {
-					util.ERROR.Printf("ACK could not be parsed: %v", err)
-					fmt.Fprintf(os.Stderr, "%s\n", msg.Payload())
-					return
-				}
-
-				// Forward ack
-				ackCh <- ack
-			})
+		// Subscribe to topics
+		if len(topics) > 0 {
+			util.INFO.Printf("Subscribing to '%s'", topicsStr)
+			token := client.SubscribeMultiple(topics, handler)
 			go func() {
 				<-token.Done()
 				if token.Error() != nil {
-					util.ERROR.Printf("Failed to subscribe to '%s': %v", ackTopic, token.Error())
+					util.ERROR.Printf("Failed to subscribe to '%s': %v", topicsStr, token.Error())
 				} else {
-					util.INFO.Printf("Susbscribed to '%s'", ackTopic)
-					close(subscribed) // Signal that subscribe has completed
+					util.INFO.Printf("Susbscribed to '%s'", topicsStr)
+					closeOnce.Do(func() { close(subscribed) }) // Signal that subscribe has completed
 				}
 			}()
 		}
@@ -228,10 +264,13 @@ func connect(config *config.Config, clientID string, isAckExpected bool, host st
 		connectionLost = true
 	}
 	options.OnReconnecting = func(client mqtt.Client, options *mqtt.ClientOptions) {
-		fmt.Println("Attempting to reconnect")
+		fmt.Fprintln(os.Stderr, "Attempting to reconnect")
 	}
 
 	// Connect to the broker
+	if config.Profile != "" {
+		util.INFO.Printf("Connecting with profile '%s'", config.Profile)
+	}
 	util.INFO.Printf("Connecting to '%s' as user '%s' with client ID '%s'", brokerUrl, *config.Username, clientID)
 	client := mqtt.NewClient(options)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
@@ -239,21 +278,64 @@ func connect(config *config.Config, clientID string, isAckExpected bool, host st
 	}
 
 	// Wait for subscribe to complete
-	if isAckExpected {
+	if len(topics) > 0 {
 		select {
 		case <-subscribed:
 			// Subscribe completed
-		case <-time.After(TIMEOUT):
-			util.ERROR.Printf("Timed out while waiting to subscribe to '%s'", ackTopic)
+		case <-time.After(timeouts.Connect):
+			util.ERROR.Printf("Timed out while waiting to subscribe to '%s'", topicsStr)
 		}
 	}
 
 	return client, nil
 }
 
-// parseCommandLine parses the command line.
-func parseCommandLine(binaryName string) []string {
+// cmdLineOptions holds the options given on the command line.
+type cmdLineOptions struct {
+	configPath string        // Path to config.json, or empty to search for it
+	profile    string        // Name of the config profile to use, or empty for the default
+	format     output.Format // Output format
+
+	// Timeouts that override those in the config file, if not zero.
+	connectTimeout time.Duration
+	ackTimeout     time.Duration
+	keepAlive      time.Duration
+
+	retries int // How many times to retry commands that aren't acknowledged
+}
+
+// applyTimeouts sets the timeouts in `cfg` to those given on the command line.
+func (options *cmdLineOptions) applyTimeouts(cfg *config.Config) {
+	for _, timeout := range []struct {
+		value time.Duration
+		field **config.Duration
+	}{
+		{options.connectTimeout, &cfg.ConnectTimeout},
+		{options.ackTimeout, &cfg.AckTimeout},
+		{options.keepAlive, &cfg.KeepAlive},
+	} {
+		if timeout.value > 0 {
+			duration := config.Duration(timeout.value)
+			*timeout.field = &duration
+		}
+	}
+}
+
+// parseCommandLine parses the command line, and returns the options and the
+// remaining non-flag arguments.
+func parseCommandLine(binaryName string) (*cmdLineOptions, []string) {
 	// Define command line flags.
+	var options cmdLineOptions
+	flag.StringVar(&options.configPath, "config", "", "Path to config.json")
+	flag.StringVar(&options.profile, "profile", "", "Name of the config profile to use")
+	formatStr := flag.String("output", string(output.HUMAN), "Output format: human, json, or yaml")
+	flag.DurationVar(&options.connectTimeout, "connect-timeout", 0,
+		fmt.Sprintf("Timeout for connecting and subscribing to the broker (default %v)", config.DEFAULT_CONNECT_TIMEOUT))
+	flag.DurationVar(&options.ackTimeout, "ack-timeout", 0,
+		fmt.Sprintf("Timeout for waiting for an ACK (default %v)", config.DEFAULT_ACK_TIMEOUT))
+	flag.DurationVar(&options.keepAlive, "keepalive", 0,
+		fmt.Sprintf("Interval between keepalive messages to the broker (default %v)", config.DEFAULT_KEEPALIVE))
+	flag.IntVar(&options.retries, "retries", 0, "How many times to retry commands that aren't acknowledged")
 	printHelp := flag.Bool("help", false, "Show help")
 	printVersion := flag.Bool("version", false, "Print version information")
 	flag.BoolVar(&util.Verbose, "verbose", false, "Print status messages")
@@ -263,21 +345,60 @@ func parseCommandLine(binaryName string) []string {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] [host] [command]\n\n", binaryName)
 		fmt.Fprintf(os.Stderr, "Sends commands to the IndySwitch MQTT broker\n\n")
+		fmt.Fprintf(os.Stderr, "The host can be a device ID or alias, a group such as @exterior, a\n")
+		fmt.Fprintf(os.Stderr, "comma-separated list of these, or a glob pattern matched against the device\n")
+		fmt.Fprintf(os.Stderr, "inventory.\n\n")
 		fmt.Fprintln(os.Stderr, "Options:")
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, "\nCommands:")
+		fmt.Fprintln(os.Stderr, "  groups (without a host)")
+		fmt.Fprintln(os.Stderr, "  suntimes [filename] [--reduce median|mid-month] (without a host)")
+		fmt.Fprintln(os.Stderr, "  suntimes --lat degrees --lon degrees --tz timezone [--twilight type] (without a host)")
+		fmt.Fprintln(os.Stderr, "  timezone [timezone] (without a host)")
 		fmt.Fprintln(os.Stderr, "  config timezone [timezone]")
 		fmt.Fprintln(os.Stderr, "  config offset [offset]")
-		fmt.Fprintln(os.Stderr, "  config suntimes [filename]")
-		fmt.Fprintln(os.Stderr, "  status [all]")
+		fmt.Fprintln(os.Stderr, "  config suntimes [filename] [--reduce median|mid-month]")
+		fmt.Fprintln(os.Stderr, "  config suntimes --lat degrees --lon degrees --tz timezone [--twilight type]")
+		fmt.Fprintln(os.Stderr, "  status [all | --fields field,... | --format template | --table] [--every interval]")
 		fmt.Fprintln(os.Stderr, "  restart")
 		fmt.Fprintln(os.Stderr, "  reset")
-		fmt.Fprintln(os.Stderr, "  switch [on|off]")
+		fmt.Fprintln(os.Stderr, "  switch [on|off] [--ensure] [--for duration]")
+		fmt.Fprintln(os.Stderr, "  switch toggle [--for duration]")
+		fmt.Fprintln(os.Stderr, "  watch (use + as the host to watch all devices)")
 		fmt.Fprintln(os.Stderr, "\nExamples:")
 		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona switch on")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona switch on --ensure")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona switch toggle")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona switch on --for 20m")
 		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona config timezone America/New_York")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona config timezone CST6")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt timezone Europe/Berlin")
 		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona config offset 30")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona config suntimes --lat 30.27 --lon -97.74 --tz America/Chicago")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt suntimes --lat 30.27 --lon -97.74 --tz America/Chicago > suntimes.json")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt suntimes daily.csv --reduce mid-month > suntimes.json")
 		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona status all")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona status --fields is_on,next_action_time")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt esp-vorona status --format '{{.Device}} {{.IsOn}}'")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt porch,garage switch off")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt 'esp-*' status")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt @exterior switch on")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt @all status --table")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt @all status --every 5m")
+		fmt.Fprintln(os.Stderr, "  indy-mqtt + watch")
+		fmt.Fprintln(os.Stderr, "\nExit status:")
+		fmt.Fprintf(os.Stderr, "  %-3d Success\n", util.EXIT_OK)
+		fmt.Fprintf(os.Stderr, "  %-3d Other error\n", 1)
+		fmt.Fprintf(os.Stderr, "  %-3d Usage error\n", util.EXIT_USAGE)
+		fmt.Fprintf(os.Stderr, "  %-3d Config or input error\n", util.EXIT_CONFIG)
+		fmt.Fprintf(os.Stderr, "  %-3d Unable to connect to broker\n", util.EXIT_CONNECT)
+		fmt.Fprintf(os.Stderr, "  %-3d Unable to publish command\n", util.EXIT_PUBLISH)
+		fmt.Fprintf(os.Stderr, "  %-3d Timed out waiting for ACK\n", util.EXIT_ACK_TIMEOUT)
+		fmt.Fprintf(os.Stderr, "  %-3d ACK returned an error status\n", util.EXIT_ACK_STATUS)
+		fmt.Fprintf(os.Stderr, "  %-3d ACK content couldn't be handled\n", util.EXIT_ACK_HANDLER)
+		fmt.Fprintf(os.Stderr, "  %-3d Switch isn't in the state requested\n", util.EXIT_VERIFY)
+		fmt.Fprintf(os.Stderr, "  %-3d Interrupted\n", util.EXIT_INTERRUPTED)
+		fmt.Fprintln(os.Stderr, "When a command fails for several hosts, the exit status is for the first that failed.")
 	}
 
 	// Parse command line.
@@ -296,5 +417,28 @@ func parseCommandLine(binaryName string) []string {
 		os.Exit(0)
 	}
 
-	return flag.Args()
+	// Check timeouts.
+	timeouts := map[string]time.Duration{"connect-timeout": options.connectTimeout, "ack-timeout": options.ackTimeout,
+		"keepalive": options.keepAlive}
+	flag.Visit(func(f *flag.Flag) {
+		if timeout, ok := timeouts[f.Name]; ok && timeout <= 0 {
+			util.PrintFatalUsage(fmt.Sprintf("-%s needs to be a positive duration, such as 45s", f.Name))
+		}
+	})
+	if options.keepAlive > 0 && options.keepAlive < config.MIN_KEEPALIVE {
+		util.PrintFatalUsage(fmt.Sprintf("-keepalive needs to be at least %v", config.MIN_KEEPALIVE))
+	}
+
+	// Check retries.
+	if options.retries < 0 {
+		util.PrintFatalUsage("retries needs to be zero or more")
+	}
+
+	// Parse output format.
+	var err error
+	if options.format, err = output.ParseFormat(*formatStr); err != nil {
+		util.PrintFatalUsage(err.Error())
+	}
+
+	return &options, flag.Args()
 }
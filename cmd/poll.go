@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"indy-mqtt/internal/command"
+	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/output"
+	"indy-mqtt/internal/util"
+)
+
+// poller polls the status of hosts, and prints the changes seen.
+type poller struct {
+	fields   []string                         // Fields to watch for changes, or empty for all but date
+	format   output.Format                    // Output format
+	statuses map[string]message.StatusContent // Last status seen for each host
+	errors   map[string]string                // Last error seen for each host, if the last poll failed
+}
+
+// watchedFields returns the fields of `status` to watch for changes.
+func (poller *poller) watchedFields(status message.StatusContent) []string {
+	if len(poller.fields) > 0 {
+		return poller.fields
+	}
+	var fields []string
+	for _, field := range message.StatusFields {
+		// The date changes every poll
+		if field != message.FIELD_DATE {
+			fields = append(fields, field)
+		}
+	}
+	var unknown []string
+	for field := range status.Unknown {
+		unknown = append(unknown, field)
+	}
+	sort.Strings(unknown)
+	return append(fields, unknown...)
+}
+
+// update records the status or error for the host of `result`, and prints
+// what changed since the last poll.
+func (poller *poller) update(result hostResult, now time.Time) {
+	host := result.cmd.Host
+	change := output.StatusChange{Time: now, Host: host}
+
+	// Did the poll fail?
+	status, ok := result.report.Content.(message.StatusContent)
+	if result.err != nil || !ok {
+		change.Error = "no status returned"
+		if result.err != nil {
+			change.Error = result.err.Error()
+		}
+		if poller.errors[host] != change.Error {
+			poller.errors[host] = change.Error
+			poller.write(change)
+		}
+		return
+	}
+	delete(poller.errors, host)
+
+	// What changed?
+	previous, seen := poller.statuses[host]
+	poller.statuses[host] = status
+	change.Initial = !seen
+	for _, field := range poller.watchedFields(status) {
+		newValue, _ := status.FieldString(field)
+		oldValue, _ := previous.FieldString(field)
+		if newValue != oldValue {
+			change.Changes = append(change.Changes, output.FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+	if len(change.Changes) > 0 {
+		poller.write(change)
+	}
+}
+
+// write prints `change`.
+func (poller *poller) write(change output.StatusChange) {
+	if err := output.WriteStatusChange(os.Stdout, poller.format, change); err != nil {
+		util.ERROR.Printf("Unable to write status change for '%s': %v", change.Host, err)
+	}
+}
+
+// runPoll gets the status of the hosts of `cmds` every `interval` using
+// `runner`, until interrupted, printing only the status fields that change.
+// A new message is created for each poll using `clientID`.
+func runPoll(runner *runner, cmds []*command.Command, clientID string, interval time.Duration, fields []string,
+	format output.Format) {
+	poller := &poller{fields: fields, format: format, statuses: make(map[string]message.StatusContent),
+		errors: make(map[string]string)}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Poll each host
+		polls := make([]*command.Command, len(cmds))
+		for i, cmd := range cmds {
+			poll := *cmd
+			poll.Message = message.NewMessage(clientID, message.EmptyContent{})
+			polls[i] = &poll
+		}
+		results := runner.runCommands(polls, output.HUMAN, true)
+		if runner.isStopped() {
+			return
+		}
+		now := time.Now()
+		for _, result := range results {
+			poller.update(result, now)
+		}
+
+		// Wait for next poll
+		select {
+		case <-ticker.C:
+		case <-runner.stopped:
+			return
+		}
+	}
+}
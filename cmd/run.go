@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"indy-mqtt/internal/command"
+	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/output"
+	"indy-mqtt/internal/util"
+)
+
+// hostResult holds the outcome of running a command on one host.
+type hostResult struct {
+	cmd    *command.Command
+	err    *runError     // Why the command failed, or nil if it succeeded
+	report output.Result // Outcome, for structured output
+}
+
+// printer writes command output, holding a mutex so that output for different
+// hosts isn't interleaved.
+type printer struct {
+	format   output.Format // Output format
+	showHost bool          // Whether to precede human output with the host name
+	deferred bool          // Whether human output is printed after all hosts finish, as by printStatusTable
+	mutex    sync.Mutex
+}
+
+// newQuietPrinter returns a printer that prints nothing, for commands whose
+// ACK content is only needed in their report.
+func newQuietPrinter() *printer {
+	return &printer{format: output.HUMAN, deferred: true}
+}
+
+// printAck prints the message and content of `ack` for `cmd`, in human format.
+func (printer *printer) printAck(cmd *command.Command, ack message.AckMessage) error {
+	printer.mutex.Lock()
+	defer printer.mutex.Unlock()
+	if printer.showHost {
+		fmt.Printf("%s:\n", cmd.Host)
+	}
+	if len(ack.Message) > 0 {
+		fmt.Println(ack.Message)
+	}
+	return cmd.HandleAck(ack.Content)
+}
+
+// printLines prints `lines` for `cmd`, in human format, unless human output is
+// deferred. Empty lines are skipped.
+func (printer *printer) printLines(cmd *command.Command, lines ...string) {
+	if printer.format.IsStructured() || printer.deferred {
+		return
+	}
+	printer.mutex.Lock()
+	defer printer.mutex.Unlock()
+	if printer.showHost {
+		fmt.Printf("%s:\n", cmd.Host)
+	}
+	for _, line := range lines {
+		if len(line) > 0 {
+			fmt.Println(line)
+		}
+	}
+}
+
+// printReport prints `report` in structured format.
+func (printer *printer) printReport(report output.Result) {
+	printer.mutex.Lock()
+	defer printer.mutex.Unlock()
+	if err := output.Write(os.Stdout, printer.format, report); err != nil {
+		util.ERROR.Printf("Unable to write result for '%s': %v", report.Host, err)
+	}
+}
+
+// runError describes why a command failed, along with the exit code for the
+// failure.
+type runError struct {
+	exitCode int
+	message  string
+}
+
+func (err *runError) Error() string {
+	return err.message
+}
+
+// newRunError returns a new runError with `exitCode` and a message created
+// from `format` and `v`.
+func newRunError(exitCode int, format string, v ...any) *runError {
+	return &runError{exitCode: exitCode, message: fmt.Sprintf(format, v...)}
+}
+
+// exitCode returns the exit code for `results`: EXIT_OK if all succeeded, and
+// otherwise the exit code for the first that failed.
+func exitCode(results []hostResult) int {
+	for _, result := range results {
+		if result.err != nil {
+			return result.err.exitCode
+		}
+	}
+	return util.EXIT_OK
+}
+
+// runner runs commands over a connection to the broker, routing each ACK
+// received to the command it's for.
+type runner struct {
+	client     mqtt.Client
+	clientID   string        // Client ID, for creating messages
+	ackTimeout time.Duration // How long to wait for each ACK
+	retries    int           // How many times to retry commands that aren't acknowledged
+	pending    sync.Map      // Maps the message ID of each command waiting for an ACK to a chan message.AckMessage
+	stopped    chan struct{} // Closed when an interrupt signal is received
+	holds      atomic.Int32  // Number of commands waiting to switch back
+	revertNow  chan struct{} // Closed when the user chooses to switch back immediately on interrupt
+}
+
+// newRunner returns a runner for `client`, connected as `clientID`, where ACKs
+// arrive on `ackCh` and are waited for up to `ackTimeout`. Commands not
+// acknowledged are retried up to `retries` times. Waiting for commands stops
+// early once a signal is received on `interrupt`.
+func newRunner(client mqtt.Client, clientID string, ackCh chan message.AckMessage, interrupt chan os.Signal,
+	ackTimeout time.Duration, retries int) *runner {
+	runner := &runner{client: client, clientID: clientID, ackTimeout: ackTimeout, retries: retries,
+		stopped: make(chan struct{}), revertNow: make(chan struct{})}
+
+	// Route each ACK to the command it's for
+	go func() {
+		for ack := range ackCh {
+			if ch, ok := runner.pending.Load(ack.ID); ok {
+				select {
+				case ch.(chan message.AckMessage) <- ack:
+				default:
+					// Duplicate ACK
+				}
+			}
+		}
+	}()
+
+	// Stop waiting on interrupt, unless commands are waiting to switch back and
+	// the user chooses to switch back immediately
+	go func() {
+		<-interrupt
+		if runner.holds.Load() > 0 {
+			fmt.Fprintln(os.Stderr, "Interrupt signal received.")
+			if confirmRevert() {
+				close(runner.revertNow)
+				<-interrupt
+			}
+		}
+		fmt.Fprintln(os.Stderr, "Interrupt signal received. Exiting...")
+		close(runner.stopped)
+	}()
+
+	return runner
+}
+
+// isStopped returns whether an interrupt signal has been received.
+func (runner *runner) isStopped() bool {
+	select {
+	case <-runner.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// runCommands publishes each of `cmds` and waits concurrently for their ACKs.
+// Output is written in `format`, or if `deferred` is true human output is left
+// to the caller. Returns the result for each command, in the same order as
+// `cmds`.
+func (runner *runner) runCommands(cmds []*command.Command, format output.Format, deferred bool) []hostResult {
+	results := make([]hostResult, len(cmds))
+	printer := &printer{format: format, showHost: len(cmds) > 1, deferred: deferred}
+	var wg sync.WaitGroup
+	for i, cmd := range cmds {
+		wg.Add(1)
+		go func(i int, cmd *command.Command) {
+			defer wg.Done()
+			result := hostResult{cmd: cmd}
+			result.report = output.Result{Host: cmd.Host, Topic: cmd.Topic, MessageID: cmd.Message.Header.MessageID}
+			switch {
+			case cmd.For > 0:
+				result.err = runner.runTimed(cmd, printer, &result.report)
+			case cmd.Check != nil:
+				result.err = runner.runChecked(cmd, printer, &result.report)
+			default:
+				result.err = runner.runCommand(cmd, printer, &result.report)
+			}
+			if result.err != nil {
+				result.report.Error = result.err.Error()
+			}
+			if format.IsStructured() {
+				printer.printReport(result.report)
+			}
+			results[i] = result
+		}(i, cmd)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Delays between attempts to publish a command, which double with each
+// attempt up to the maximum.
+const RETRY_BASE_DELAY = 1 * time.Second
+const RETRY_MAX_DELAY = 30 * time.Second
+
+// retryDelay returns how long to wait before retrying after attempt number
+// `attempt`. The delay grows exponentially, with jitter so that retries for
+// many hosts are spread out.
+func retryDelay(attempt int) time.Duration {
+	delay := RETRY_MAX_DELAY
+	if attempt < 16 {
+		delay = min(RETRY_BASE_DELAY<<(attempt-1), RETRY_MAX_DELAY)
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// publish publishes `msg` for `cmd`, and waits for the publish to complete.
+func (runner *runner) publish(cmd *command.Command, msg *message.Message) *runError {
+	messageBytes, err := json.Marshal(msg)
+	if err != nil {
+		return newRunError(util.EXIT_PUBLISH, "error marshaling message: %v", err)
+	}
+	if util.Verbose {
+		util.INFO.Printf("Publishing to topic '%s'", cmd.Topic)
+		prettyJSON := marshalToJSONString(msg)
+		util.INFO.Printf("Message:\n%s", prettyJSON)
+	}
+	token := runner.client.Publish(cmd.Topic, cmd.QOS, false, messageBytes)
+
+	// Wait for the publish to complete, or an interrupt signal
+	select {
+	case <-token.Done():
+		if token.Error() != nil {
+			util.ERROR.Printf("Failed to publish to '%s': %v", cmd.Host, token.Error())
+			return newRunError(util.EXIT_PUBLISH, "failed to publish: %v", token.Error())
+		}
+		util.INFO.Printf("Message published to '%s' successfully", cmd.Host)
+		return nil
+	case <-runner.stopped:
+		return newRunError(util.EXIT_INTERRUPTED, "interrupted")
+	}
+}
+
+// runCommand publishes `cmd` and waits for its ACK, if an ACK is expected. If
+// the publish fails or no ACK arrives, the command is published again with a
+// new message ID, up to runner.retries more times. An ACK for any of the
+// messages published counts as success. The outcome is recorded in `report`,
+// and in human format the ACK is also printed with `printer`. Returns an
+// error if the command failed.
+func (runner *runner) runCommand(cmd *command.Command, printer *printer, report *output.Result) *runError {
+	// Route the ACKs for every message published to the same channel
+	ackCh := make(chan message.AckMessage, 1)
+	var messageIDs []string
+	defer func() {
+		for _, messageID := range messageIDs {
+			runner.pending.Delete(messageID)
+		}
+	}()
+
+	// Publish until acknowledged
+	var ack message.AckMessage
+	start := time.Now()
+attempts:
+	for attempt := 1; ; attempt++ {
+		// Publish message
+		msg := cmd.Message
+		if attempt > 1 {
+			msg = message.NewMessage(runner.clientID, cmd.Message.Content)
+		}
+		messageIDs = append(messageIDs, msg.Header.MessageID)
+		runner.pending.Store(msg.Header.MessageID, ackCh)
+		report.Attempts = attempt
+		err := runner.publish(cmd, msg)
+		if err == nil {
+			report.Published = true
+			if !cmd.IsAckExpected {
+				return nil
+			}
+
+			// Watch for ACK or interrupt signal
+			util.INFO.Printf("Watching for ACK from '%s'", cmd.Host)
+			select {
+			case ack = <-ackCh:
+				break attempts
+			case <-time.After(runner.ackTimeout):
+				err = newRunError(util.EXIT_ACK_TIMEOUT, "timed out while waiting for ACK")
+			case <-runner.stopped:
+				return newRunError(util.EXIT_INTERRUPTED, "interrupted")
+			}
+		}
+		if err.exitCode == util.EXIT_INTERRUPTED {
+			return err
+		}
+
+		// Give up?
+		if attempt > runner.retries {
+			if err.exitCode == util.EXIT_ACK_TIMEOUT {
+				util.ERROR.Printf("Timed out while waiting for ACK from '%s'", cmd.Host)
+			}
+			if attempt > 1 {
+				err.message += fmt.Sprintf(" after %d attempts", attempt)
+			}
+			return err
+		}
+
+		// Wait before retrying, while still accepting a late ACK
+		delay := retryDelay(attempt)
+		util.WARNING.Printf("Attempt %d for '%s' failed (%v); retrying in %v", attempt, cmd.Host, err, delay.Round(time.Millisecond))
+		select {
+		case ack = <-ackCh:
+			break attempts
+		case <-time.After(delay):
+		case <-runner.stopped:
+			return newRunError(util.EXIT_INTERRUPTED, "interrupted")
+		}
+	}
+
+	// ACK was received
+	report.MessageID = ack.ID
+	report.Acked = true
+	report.LatencyMS = time.Since(start).Milliseconds()
+	report.StatusCode = ack.StatusCode
+	report.Message = ack.Message
+	if report.Attempts > 1 && !printer.format.IsStructured() {
+		fmt.Fprintf(os.Stderr, "Message to '%s' acknowledged after %d attempts\n", cmd.Host, report.Attempts)
+	}
+
+	// Handle ACK
+	const STATUS_CODE_OK = 200
+	if ack.StatusCode != STATUS_CODE_OK {
+		util.ERROR.Printf("ACK error code %d from '%s': %s", ack.StatusCode, cmd.Host, ack.Message)
+		return newRunError(util.EXIT_ACK_STATUS, "ACK error code %d: %s", ack.StatusCode, ack.Message)
+	}
+	util.INFO.Printf("Message to '%s' was successfully acknowledged", cmd.Host)
+	if printer.format.IsStructured() || printer.deferred {
+		if len(ack.Content) == 0 {
+			return nil
+		}
+		content, err := cmd.DecodeAck(ack.Content)
+		if err != nil {
+			util.ERROR.Printf("Failed to handle ack from '%s': %v", cmd.Host, err)
+			return newRunError(util.EXIT_ACK_HANDLER, "failed to handle ACK: %v", err)
+		}
+		report.Content = content
+		return nil
+	}
+	if err := printer.printAck(cmd, ack); err != nil {
+		util.ERROR.Printf("Failed to handle ack from '%s': %v", cmd.Host, err)
+		return newRunError(util.EXIT_ACK_HANDLER, "failed to handle ACK: %v", err)
+	}
+
+	return nil
+}
+
+// printSummary prints whether the command succeeded or failed for each host.
+func printSummary(results []hostResult) {
+	fmt.Println("Summary:")
+	for _, result := range results {
+		if result.err == nil {
+			fmt.Printf("  %s: ok\n", result.cmd.Host)
+		} else {
+			fmt.Printf("  %s: FAILED (%v)\n", result.cmd.Host, result.err)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+
+	"indy-mqtt/internal/suntimes"
+	"indy-mqtt/internal/util"
+)
+
+// printSuntimes prints the sunrise and sunset times given by `args`, either
+// generated for a site or read from a file, as JSON that config suntimes can
+// read.
+func printSuntimes(args []string) {
+	times, err := suntimes.Load(args)
+	if err != nil {
+		util.PrintFatalError(err)
+	}
+	fmt.Print(suntimes.Format(times))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"indy-mqtt/internal/command"
+	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/output"
+	"indy-mqtt/internal/util"
+)
+
+// stateName returns "on" or "off" for switch state `isOn`.
+func stateName(isOn bool) string {
+	if isOn {
+		return "on"
+	}
+	return "off"
+}
+
+// getSwitchState gets the status of the host of `cmd` with cmd.Check, and
+// returns whether the switch is on.
+func (runner *runner) getSwitchState(cmd *command.Command) (bool, *runError) {
+	check := *cmd.Check
+	check.Message = message.NewMessage(runner.clientID, message.EmptyContent{})
+	var report output.Result
+	if err := runner.runCommand(&check, newQuietPrinter(), &report); err != nil {
+		return false, err
+	}
+	status, ok := report.Content.(message.StatusContent)
+	if !ok || !status.Has(message.FIELD_IS_ON) {
+		util.ERROR.Printf("Status from '%s' is missing %s", cmd.Host, message.FIELD_IS_ON)
+		return false, newRunError(util.EXIT_ACK_HANDLER, "status is missing %s", message.FIELD_IS_ON)
+	}
+	return status.IsOn, nil
+}
+
+// runChecked runs control command `cmd`, using cmd.Check to get the switch
+// state first and skip publishing if the switch is already in the state
+// requested, and to verify the state after the command is acknowledged. If
+// cmd.Toggle is true, the switch is switched to the opposite state instead. The
+// outcome is recorded in `report`, and in human format also printed with
+// `printer`. Returns an error if the command failed or the state doesn't
+// match.
+func (runner *runner) runChecked(cmd *command.Command, printer *printer, report *output.Result) *runError {
+	// What state is the switch in?
+	isOn, err := runner.getSwitchState(cmd)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	if cmd.Toggle {
+		toggled := *cmd
+		toggled.Message = message.NewMessage(runner.clientID, message.ControlContent{SwitchOn: !isOn})
+		cmd = &toggled
+		lines = append(lines, "Switch was "+stateName(isOn))
+	}
+	switchOn := cmd.Message.Content.(message.ControlContent).SwitchOn
+
+	// Is the switch already in the state requested?
+	if isOn == switchOn {
+		util.INFO.Printf("Switch '%s' is already %s", cmd.Host, stateName(isOn))
+		report.Skipped = true
+		report.IsOn = &isOn
+		printer.printLines(cmd, "Switch is already "+stateName(isOn))
+		return nil
+	}
+
+	// Switch, without printing the ACK yet
+	if err := runner.runCommand(cmd, newQuietPrinter(), report); err != nil {
+		return err
+	}
+
+	// Verify the state
+	if isOn, err = runner.getSwitchState(cmd); err != nil {
+		return err
+	}
+	report.IsOn = &isOn
+	if isOn != switchOn {
+		util.ERROR.Printf("Switch '%s' is %s after being switched %s", cmd.Host, stateName(isOn), stateName(switchOn))
+		return newRunError(util.EXIT_VERIFY, "switch is %s after being switched %s", stateName(isOn), stateName(switchOn))
+	}
+	lines = append(lines, report.Message, "Verified switch is "+stateName(isOn))
+	printer.printLines(cmd, lines...)
+
+	return nil
+}
+
+// confirmRevert asks the user whether to switch back immediately, returning
+// true unless the answer is no.
+func confirmRevert() bool {
+	fmt.Fprint(os.Stderr, "Switch back now? [Y/n] ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer != "n" && answer != "no"
+}
+
+// runTimed runs control command `cmd`, leaves the switch in the state
+// requested for cmd.For, and then switches it back, waiting for the ACK. The
+// wait ends early if the user chooses to switch back when interrupted. The
+// outcome is recorded in `report`, with the outcome of switching back in
+// report.Revert, and in human format also printed with `printer`. Returns an
+// error if either command failed.
+func (runner *runner) runTimed(cmd *command.Command, printer *printer, report *output.Result) *runError {
+	// Switch
+	var err *runError
+	if cmd.Check != nil {
+		err = runner.runChecked(cmd, printer, report)
+	} else {
+		err = runner.runCommand(cmd, printer, report)
+	}
+	if err != nil || report.Skipped {
+		return err
+	}
+	switchedOn := cmd.Message.Content.(message.ControlContent).SwitchOn
+	if report.IsOn != nil {
+		switchedOn = *report.IsOn
+	}
+
+	// Wait
+	runner.holds.Add(1)
+	revertTime := time.Now().Add(cmd.For)
+	fmt.Fprintf(os.Stderr, "Switch '%s' will be turned %s at %s\n", cmd.Host, stateName(!switchedOn), revertTime.Format(time.TimeOnly))
+	select {
+	case <-time.After(cmd.For):
+	case <-runner.revertNow:
+	case <-runner.stopped:
+		runner.holds.Add(-1)
+		util.WARNING.Printf("Leaving switch '%s' %s", cmd.Host, stateName(switchedOn))
+		return newRunError(util.EXIT_INTERRUPTED, "interrupted, leaving the switch %s", stateName(switchedOn))
+	}
+	runner.holds.Add(-1)
+
+	// Switch back
+	revert := *cmd
+	revert.Message = message.NewMessage(runner.clientID, message.ControlContent{SwitchOn: !switchedOn})
+	revert.Toggle = false
+	report.Revert = &output.Result{Host: revert.Host, Topic: revert.Topic, MessageID: revert.Message.Header.MessageID}
+	if revert.Check != nil {
+		err = runner.runChecked(&revert, newQuietPrinter(), report.Revert)
+	} else {
+		err = runner.runCommand(&revert, newQuietPrinter(), report.Revert)
+	}
+	if err != nil {
+		report.Revert.Error = err.Error()
+		return newRunError(err.exitCode, "failed to switch back %s: %v", stateName(!switchedOn), err)
+	}
+	isOn := !switchedOn
+	report.IsOn = &isOn
+	printer.printLines(cmd, report.Revert.Message)
+
+	return nil
+}
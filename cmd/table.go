@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/util"
+)
+
+// printStatusTable prints the status from `results` as a table with a row for
+// each host. Hosts that didn't return a status are shown with why, such as
+// "timeout", in place of their state.
+func printStatusTable(results []hostResult) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "DEVICE\tSTATE\tNEXT ACTION\tNEXT ACTION TIME\tOFFSET\tFIRMWARE\tLATENCY")
+	for _, result := range results {
+		// Did the host return a status?
+		status, ok := result.report.Content.(message.StatusContent)
+		if result.err != nil || !ok {
+			state := "error"
+			if result.err != nil && result.err.exitCode == util.EXIT_ACK_TIMEOUT {
+				state = "timeout"
+			}
+			fmt.Fprintf(writer, "%s\t%s\t-\t-\t-\t-\t-\n", result.cmd.Host, state)
+			continue
+		}
+
+		// Print status
+		field := func(name string) string {
+			if str, ok := status.FieldString(name); ok {
+				return str
+			}
+			return "-"
+		}
+		state := "-"
+		if status.Has(message.FIELD_IS_ON) {
+			state = stateName(status.IsOn)
+		}
+		latency := time.Duration(result.report.LatencyMS) * time.Millisecond
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%v\n", result.cmd.Host, state,
+			field(message.FIELD_NEXT_ACTION), field(message.FIELD_NEXT_ACTION_TIME),
+			field(message.FIELD_OFFSET), field(message.FIELD_FIRMWARE), latency)
+	}
+	writer.Flush()
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+
+	"indy-mqtt/internal/timezone"
+	"indy-mqtt/internal/util"
+)
+
+// printTimezone prints the POSIX TZ string for the timezone given by `args`,
+// which is either a POSIX TZ string or an IANA timezone name.
+func printTimezone(args []string) {
+	if len(args) != 1 {
+		util.PrintFatalUsage("timezone command is expecting a single timezone")
+	}
+	tz, err := timezone.Resolve(args[0])
+	if err != nil {
+		util.FatalExitf(util.EXIT_CONFIG, "Unable to convert timezone: %v", err)
+	}
+	fmt.Println(tz)
+}
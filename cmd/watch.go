@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"indy-mqtt/internal/config"
+	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/output"
+	"indy-mqtt/internal/util"
+)
+
+// ALL_DEVICES is the host given to watch every device, whether or not it's in
+// the inventory.
+const ALL_DEVICES = "+"
+
+// watcher decodes and prints the messages seen on IndySwitch topics.
+type watcher struct {
+	format         output.Format
+	mutex          sync.Mutex
+	statusRequests map[string]bool // IDs of status requests seen, so their ACKs can be decoded as status
+}
+
+// handleMessage decodes and prints `msg`.
+func (watcher *watcher) handleMessage(_ mqtt.Client, msg mqtt.Message) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	// Parse topic
+	host, kind, err := message.ParseTopic(msg.Topic())
+	if err != nil {
+		util.WARNING.Printf("%v", err)
+		return
+	}
+	event := output.Event{Time: time.Now(), Host: host, Kind: kind}
+
+	// Decode payload
+	payload, err := message.DecodePayload(kind, msg.Payload())
+	if err != nil {
+		event.Payload = string(msg.Payload())
+		event.Error = err.Error()
+	} else {
+		event.Payload = watcher.decodeStatus(payload)
+	}
+
+	// Print event
+	if err := output.WriteEvent(os.Stdout, watcher.format, event); err != nil {
+		util.ERROR.Printf("Unable to write event: %v", err)
+	}
+}
+
+// decodeStatus returns `payload` with the content of ACKs for status requests
+// decoded as message.StatusContent. Status requests are remembered so that
+// their ACKs can be recognized.
+func (watcher *watcher) decodeStatus(payload any) any {
+	switch payload := payload.(type) {
+	case message.Message:
+		if _, ok := payload.Content.(*message.EmptyContent); ok {
+			watcher.statusRequests[payload.Header.MessageID] = true
+		}
+	case message.AckMessage:
+		if watcher.statusRequests[payload.ID] {
+			delete(watcher.statusRequests, payload.ID)
+			var status message.StatusContent
+			if err := json.Unmarshal(payload.Content, &status); err == nil {
+				return struct {
+					message.AckMessage
+					Content message.StatusContent `json:"content"`
+				}{payload, status}
+			}
+		}
+	}
+	return payload
+}
+
+// runWatch subscribes to every topic for the hosts in `hostSpec`, and prints
+// the messages published to them in `format` until interrupted. The host
+// ALL_DEVICES watches every device.
+func runWatch(config *config.Config, clientID string, hostSpec string, args []string, format output.Format) {
+	// Are there any unexpected arguments?
+	if len(args) != 0 {
+		util.PrintFatalUsage("unexpected arguments for watch command")
+	}
+
+	// What hosts?
+	var hosts []string
+	if hostSpec == ALL_DEVICES {
+		hosts = []string{ALL_DEVICES}
+	} else {
+		devices, err := config.Resolve(hostSpec)
+		if err != nil {
+			util.PrintFatalUsage(err.Error())
+		}
+		for _, device := range devices {
+			hosts = append(hosts, device.ID)
+		}
+	}
+	const WATCH_QOS = 1
+	topics := make(map[string]byte, len(hosts))
+	for _, host := range hosts {
+		topics[fmt.Sprintf("%s/%s/#", message.TOPIC_PREFIX, host)] = WATCH_QOS
+	}
+
+	// Connect to MQTT broker, with a client ID of its own so that commands can
+	// be sent from the same machine while watching
+	config.ResolvePassword()
+	watcher := &watcher{format: format, statusRequests: make(map[string]bool)}
+	clientID = fmt.Sprintf("%s-watch-%s", clientID, util.GenerateHexSuffix())
+	client, err := connect(config, clientID, topics, watcher.handleMessage)
+	if err != nil {
+		util.FatalExitf(util.EXIT_CONNECT, "Unable to connect: %v", err)
+	}
+
+	// Watch until interrupted
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	util.INFO.Printf("Interrupt signal received. Exiting...")
+
+	// Disconnect from the broker
+	disconnect(client)
+}
@@ -2,8 +2,9 @@ module indy-mqtt
 
 go 1.21.1
 
+require github.com/eclipse/paho.mqtt.golang v1.4.3
+
 require (
-	github.com/eclipse/paho.mqtt.golang v1.4.3 // indirect
 	github.com/gorilla/websocket v1.5.0 // indirect
 	golang.org/x/net v0.8.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
@@ -4,24 +4,36 @@ package command
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
-	"os"
+	"io"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
+	"indy-mqtt/internal/config"
 	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/suntimes"
+	"indy-mqtt/internal/timezone"
+	"indy-mqtt/internal/util"
 )
 
 // Command holds the contents of a command: what MQTT broker and topic to
 // publish to, what to publish, what results are expected, and do with them.
 type Command struct {
 	Host          string           // Name of device
+	Device        config.Device    // Inventory entry for device
 	Topic         string           // MQTT topic
 	QOS           byte             // MQTT QOS
 	Message       *message.Message // Payload to publish
 	IsAckExpected bool             // Whether an ACK response is expected
 	AckHandler    AckHandler       // Handles ACK content
+	Check         *Command         // Status command to check the switch state with before and after publishing, if not nil
+	Toggle        bool             // Whether the control command switches to the opposite of the state Check finds
+	For           time.Duration    // How long to leave the switch in the state requested before switching it back, or 0 to leave it
 }
 
 // HandleAck calls the AckHandler if there is one, passing it the `content`
@@ -33,93 +45,105 @@ func (command Command) HandleAck(content []byte) error {
 	return nil
 }
 
+// DecodeAck returns the `content` from the ACK decoded by the AckHandler, if
+// the AckHandler is also an AckDecoder, and otherwise returns `content` as is.
+func (command Command) DecodeAck(content []byte) (any, error) {
+	if decoder, ok := command.AckHandler.(AckDecoder); ok {
+		return decoder.DecodeAck(content)
+	}
+	return json.RawMessage(content), nil
+}
+
 // AckHandler is implemented for Commands that need to perform some action with
 // the contents of an ACK.
 type AckHandler interface {
 	HandleAck(content []byte) error
 }
 
+// AckDecoder is implemented by AckHandlers that can decode the contents of an
+// ACK into a typed value, for structured output.
+type AckDecoder interface {
+	DecodeAck(content []byte) (any, error)
+}
+
 // GetStatusAckHandler implements AckHandler for the get status command.
 type GetStatusAckHandler struct {
-	All bool // Whether to print all status fields or just a subset.
+	All              bool               // Whether to print all status fields or just a subset.
+	Fields           []string           // Status fields to print, overriding All, if not empty.
+	Template         *template.Template // Template to print status with, overriding Fields, if not nil.
+	Table            bool               // Whether status is printed as a row of a table instead of by HandleAck.
+	Every            time.Duration      // Interval to poll status at, printing only changes, or 0 to get status once.
+	ExpectedFirmware string             // Firmware version the device should report, if known.
 }
 
-// createStrFromJsonObj returns a one-line string representation of `obj`,
-// where obj is a JSON object with keys that can be parsed as integers (e.g.
-// suntimes).
-func createStrFromJsonObj(obj json.RawMessage) (string, error) {
-	// Is this an object?
-	if obj[0] != '{' {
-		return "", fmt.Errorf("object not found")
+// DecodeAck decodes the ACK content for the get status command into a
+// message.StatusContent.
+func (handler GetStatusAckHandler) DecodeAck(content []byte) (any, error) {
+	var status message.StatusContent
+	if err := json.Unmarshal(content, &status); err != nil {
+		return nil, fmt.Errorf("unable to parse status '%s': %v", string(content), err)
 	}
 
-	// Parse JSON
-	var data map[string]json.RawMessage
-	if err := json.Unmarshal(obj, &data); err != nil {
-		return "", fmt.Errorf("error unmarshaling: %v", err)
+	// Were any fields malformed?
+	for _, warning := range status.Warnings() {
+		util.WARNING.Printf("Status %v", warning)
 	}
 
-	// Sort keys
-	keys := make([]int, 0, len(data))
-	for key := range data {
-		var keyInt int
-		var err error
-		if keyInt, err = strconv.Atoi(key); err != nil {
-			return "", fmt.Errorf("integer not found for key '%s'", key)
-		}
-		keys = append(keys, keyInt)
+	// Is the firmware the version expected?
+	if status.Has(message.FIELD_FIRMWARE) && handler.ExpectedFirmware != "" && status.Firmware != handler.ExpectedFirmware {
+		util.WARNING.Printf("Device reports firmware '%s' instead of the expected '%s'", status.Firmware, handler.ExpectedFirmware)
 	}
-	sort.Ints(keys)
 
-	// Build string
-	var builder strings.Builder
-	for i, keyInt := range keys {
-		if i > 0 {
-			builder.WriteString(", ")
-		}
-		key := strconv.Itoa(keyInt)
-		value := data[key]
-		builder.WriteString(fmt.Sprintf("%s: %s", key, value))
+	// Select fields
+	if len(handler.Fields) > 0 {
+		status = status.Select(handler.Fields)
 	}
 
-	return builder.String(), nil
+	return status, nil
 }
 
 // HandleAck handles the ACK content for the get status command, by printing the
 // status returned with the ACK.
 func (handler GetStatusAckHandler) HandleAck(content []byte) error {
+	// Parse status
+	decoded, err := handler.DecodeAck(content)
+	if err != nil {
+		return err
+	}
+	status := decoded.(message.StatusContent)
+
+	// Print with template
+	if handler.Template != nil {
+		var builder strings.Builder
+		if err := handler.Template.Execute(&builder, status); err != nil {
+			return fmt.Errorf("unable to execute format template: %v", err)
+		}
+		output := builder.String()
+		if !strings.HasSuffix(output, "\n") {
+			output += "\n"
+		}
+		fmt.Print(output)
+		return nil
+	}
+
 	// Which attributes to print?
 	var attrs []string
-	if handler.All {
-		attrs = []string{"device", "firmware", "date", "is_on", "sunrise",
-			"sunset", "offset", "next_action", "next_action_time", "suntimes"}
+	if len(handler.Fields) > 0 {
+		attrs = handler.Fields
+	} else if handler.All {
+		attrs = append(attrs, message.StatusFields...)
+		for attr := range status.Unknown {
+			attrs = append(attrs, attr)
+		}
+		sort.Strings(attrs[len(message.StatusFields):])
 	} else {
-		attrs = []string{"date", "is_on", "sunrise", "sunset", "offset",
-			"next_action", "next_action_time"}
-	}
-
-	// Unmarshal the JSON into a map
-	var data map[string]json.RawMessage
-	if err := json.Unmarshal(content, &data); err != nil {
-		return fmt.Errorf("unable to parse ACK JSON content '%s': %v", string(content), err)
+		attrs = []string{message.FIELD_DATE, message.FIELD_IS_ON, message.FIELD_SUNRISE, message.FIELD_SUNSET,
+			message.FIELD_OFFSET, message.FIELD_NEXT_ACTION, message.FIELD_NEXT_ACTION_TIME}
 	}
 
 	// Print status
 	for _, attr := range attrs {
-		if val, ok := data[attr]; ok {
-			var valStr string
-			if val[0] == '{' {
-				// val is a JSON object (currently just suntimes)
-				var err error
-				valStr, err = createStrFromJsonObj(val)
-				if err != nil {
-					return err
-				}
-			} else {
-				// val is not a JSON object
-				valStr = string(val)
-				valStr = strings.Trim(valStr, "\"")
-			}
+		if valStr, ok := status.FieldString(attr); ok {
 			fmt.Printf("%s: %s\n", attr, valStr)
 		}
 	}
@@ -127,15 +151,45 @@ func (handler GetStatusAckHandler) HandleAck(content []byte) error {
 	return nil
 }
 
-// NewCommand creates a new Command based on the command line `args` provided by the user.
-func NewCommand(clientID string, args []string) (*Command, error) {
-	// What host?
+// HostResolver is implemented by types that can resolve the host given on the
+// command line into devices, such as config.Config.
+type HostResolver interface {
+	Resolve(spec string) ([]config.Device, error)
+}
+
+// NewCommand creates new Commands based on the command line `args` provided
+// by the user, one for each host. The host given in `args` can be a device ID
+// or alias, a group, a comma-separated list of these, or a glob pattern, as
+// resolved by `hosts`.
+func NewCommand(clientID string, args []string, hosts HostResolver) ([]*Command, error) {
+	// What hosts?
 	if len(args) == 0 {
 		return nil, fmt.Errorf("no host specified")
 	}
-	host := args[0]
+	devices, err := hosts.Resolve(args[0])
+	if err != nil {
+		return nil, err
+	}
 	args = args[1:]
 
+	// Create a command for each host
+	cmds := make([]*Command, 0, len(devices))
+	for _, device := range devices {
+		cmd, err := newDeviceCommand(clientID, device, args)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds, nil
+}
+
+// newDeviceCommand creates a new Command for `device`, based on the command
+// line `args` that follow the host.
+func newDeviceCommand(clientID string, device config.Device, args []string) (*Command, error) {
+	host := device.ID
+
 	// What command is this?
 	if len(args) == 0 {
 		return nil, fmt.Errorf("no command specified")
@@ -175,32 +229,82 @@ func NewCommand(clientID string, args []string) (*Command, error) {
 	default:
 		return nil, fmt.Errorf("unrecognized command %s", cmdStr)
 	}
+	cmd.Device = device
+	if handler, ok := cmd.AckHandler.(GetStatusAckHandler); ok {
+		handler.ExpectedFirmware = device.Firmware
+		cmd.AckHandler = handler
+	}
+
+	// Is the timezone being configured the one expected?
+	if content, ok := cmd.Message.Content.(message.ConfigContent); ok && device.Timezone != "" {
+		if tz, ok := content.Settings["timezone"].(string); ok {
+			expected, err := timezone.Resolve(device.Timezone)
+			if err != nil {
+				util.WARNING.Printf("Unable to check timezone for device '%s': %v", device.ID, err)
+			} else if tz != expected {
+				util.WARNING.Printf("Setting timezone '%s' instead of the expected '%s' for device '%s'", tz, expected, device.ID)
+			}
+		}
+	}
 
 	return cmd, nil
 }
 
-// NewControlCommand creates a control command, to turn switch `host` on or off.
+// NewControlCommand creates a control command, to turn switch `host` on or off,
+// or toggle it. With --ensure, the command also has a status command to check
+// the switch state with, so that nothing is published if the switch is already
+// in the state requested, and the state is verified after switching. Toggling
+// always checks the switch state, to know what to switch it to. With --for, the
+// switch is switched back after the duration given.
 func NewControlCommand(clientID string, host string, args []string) (*Command, error) {
 	// On or off?
 	if len(args) == 0 {
-		return nil, fmt.Errorf("switch command is missing the on/off parameter")
+		return nil, fmt.Errorf("switch command is missing the on/off/toggle parameter")
 	}
 	switchOnStr := args[0]
 	args = args[1:]
-	if switchOnStr != "on" && switchOnStr != "off" {
-		return nil, fmt.Errorf("switch command is expecting on or off instead of %s", switchOnStr)
+	if switchOnStr != "on" && switchOnStr != "off" && switchOnStr != "toggle" {
+		return nil, fmt.Errorf("switch command is expecting on, off, or toggle instead of %s", switchOnStr)
 	}
 	switchOn := switchOnStr == "on"
+	toggle := switchOnStr == "toggle"
+
+	// Parse options
+	flags := flag.NewFlagSet("switch", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	ensure := flags.Bool("ensure", false, "")
+	forDuration := flags.Duration("for", 0, "")
+	if err := flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("switch command: %v", err)
+	}
+	args = flags.Args()
 
 	// Are there any unexpected arguments?
 	if len(args) != 0 {
 		return nil, fmt.Errorf("unexpected arguments for switch command")
 	}
+	if toggle && *ensure {
+		return nil, fmt.Errorf("switch toggle always checks the switch state, and can't use --ensure")
+	}
+	if *forDuration < 0 {
+		return nil, fmt.Errorf("switch --for needs to be a positive duration, such as 20m")
+	}
 
-	// Create control command
+	// Create control command. When toggling, the message published is
+	// replaced once the switch state is known.
 	topic := fmt.Sprintf("indy-switch/%s/control", host)
 	msg := message.NewMessage(clientID, message.ControlContent{SwitchOn: switchOn})
-	cmd := &Command{Host: host, Topic: topic, QOS: 2, Message: msg, IsAckExpected: true}
+	cmd := &Command{Host: host, Topic: topic, QOS: 2, Message: msg, IsAckExpected: true, Toggle: toggle,
+		For: *forDuration}
+
+	// Check the switch state?
+	if *ensure || toggle {
+		check, err := NewGetStatusCommand(clientID, host, []string{"--fields", message.FIELD_IS_ON})
+		if err != nil {
+			return nil, err
+		}
+		cmd.Check = check
+	}
 
 	return cmd, nil
 }
@@ -220,9 +324,18 @@ func NewConfigCommand(clientID string, host string, args []string) (*Command, er
 		if len(args) == 0 {
 			return nil, fmt.Errorf("timezone missing")
 		}
-		timezone := args[0]
+		name := args[0]
 		args = args[1:]
-		settings[settingName] = timezone
+
+		// Convert to POSIX TZ string
+		tz, err := timezone.Resolve(name)
+		if err != nil {
+			return nil, util.InputError{Err: fmt.Errorf("unable to convert timezone: %v", err)}
+		}
+		if tz != name {
+			util.INFO.Printf("Timezone '%s' is '%s'", name, tz)
+		}
+		settings[settingName] = tz
 	case "offset":
 		// What offset?
 		if len(args) == 0 {
@@ -236,19 +349,14 @@ func NewConfigCommand(clientID string, host string, args []string) (*Command, er
 		}
 		settings[settingName] = offset
 	case "suntimes":
-		// What file?
-		if len(args) == 0 {
-			return nil, fmt.Errorf("file name missing")
-		}
-		filename := args[0]
-		args = args[1:]
-
-		// Parse file
-		suntimes, err := readSuntimes(filename)
+		// Read file, or generate for site
+		times, err := suntimes.Load(args)
 		if err != nil {
 			return nil, err
 		}
-		settings[settingName] = suntimes
+		args = nil
+		util.INFO.Printf("Suntimes: %v", times)
+		settings[settingName] = times
 	default:
 		return nil, fmt.Errorf("unrecognized setting %s", settingName)
 	}
@@ -267,27 +375,89 @@ func NewConfigCommand(clientID string, host string, args []string) (*Command, er
 }
 
 // NewGetStatusCommand creates a get status command, to get the status of switch `host`.
+//
+// The status printed is selected by `args`, which can be "all" to print all
+// fields, or the options --fields with a comma-separated list of fields to
+// print, --format with a text/template to print the message.StatusContent
+// with, or --table to print the status of each host as a row of a table.
+// --every polls status at an interval instead, printing only changes.
 func NewGetStatusCommand(clientID string, host string, args []string) (*Command, error) {
-	// Print all status fields, or just a subset?
-	all := false
-	if len(args) == 1 {
-		allStr := args[0]
-		args = args[1:]
-		if allStr != "all" {
-			return nil, fmt.Errorf("status command is expecting all instead of %s", allStr)
+	// Parse options
+	var handler GetStatusAckHandler
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	fieldsStr := flags.String("fields", "", "")
+	formatStr := flags.String("format", "", "")
+	flags.BoolVar(&handler.Table, "table", false, "")
+	flags.DurationVar(&handler.Every, "every", 0, "")
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, fmt.Errorf("status command: %v", err)
 		}
-		all = true
+		args = flags.Args()
+
+		// Print all status fields, or just a subset?
+		if len(args) == 0 || args[0] != "all" || handler.All {
+			break
+		}
+		handler.All = true
+		args = args[1:]
 	}
 
 	// Are there any unexpected arguments?
 	if len(args) != 0 {
-		return nil, fmt.Errorf("unexpected arguments for status command")
+		return nil, fmt.Errorf("status command is expecting all, --fields, --format, --table, or --every instead of %s", strings.Join(args, " "))
+	}
+
+	// Parse fields
+	if *fieldsStr != "" {
+		if handler.All {
+			return nil, fmt.Errorf("status command can't use both all and --fields")
+		}
+		for _, field := range strings.Split(*fieldsStr, ",") {
+			field = strings.TrimSpace(field)
+			if !slices.Contains(message.StatusFields, field) {
+				return nil, fmt.Errorf("unknown status field '%s' (expected one of %s)", field, strings.Join(message.StatusFields, ", "))
+			}
+			handler.Fields = append(handler.Fields, field)
+		}
+	}
+
+	// Print as table?
+	if handler.Table && (handler.All || *fieldsStr != "" || *formatStr != "") {
+		return nil, fmt.Errorf("status command can't use --table with all, --fields, or --format")
+	}
+
+	// Poll?
+	if handler.Every < 0 {
+		return nil, fmt.Errorf("status --every needs to be a positive duration, such as 5m")
+	}
+	if handler.Every > 0 && (handler.Table || *formatStr != "") {
+		return nil, fmt.Errorf("status command can't use --every with --table or --format")
+	}
+
+	// Parse template
+	if *formatStr != "" {
+		if handler.All || len(handler.Fields) > 0 {
+			return nil, fmt.Errorf("status command can't use --format with all or --fields")
+		}
+		tmpl, err := template.New("status").Option("missingkey=error").Parse(*formatStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status format: %v", err)
+		}
+
+		// Check the fields used by executing the template with an empty status,
+		// so that unknown fields are caught before anything is published
+		if err := tmpl.Execute(io.Discard, message.StatusContent{}); err != nil {
+			return nil, fmt.Errorf("invalid status format: %v", err)
+		}
+		handler.Template = tmpl
 	}
 
 	// Create command
 	topic := fmt.Sprintf("indy-switch/%s/status/get", host)
 	msg := message.NewMessage(clientID, message.EmptyContent{})
-	cmd := &Command{Host: host, Topic: topic, QOS: 2, Message: msg, IsAckExpected: true, AckHandler: GetStatusAckHandler{All: all}}
+	cmd := &Command{Host: host, Topic: topic, QOS: 2, Message: msg, IsAckExpected: true, AckHandler: handler}
 
 	return cmd, nil
 }
@@ -321,39 +491,3 @@ func NewResetCommand(clientID string, host string, args []string) (*Command, err
 
 	return cmd, nil
 }
-
-// readSuntimes reads and parses the JSON suntimes file `filename`, and returns
-// the results. The expected format for the JSON is the same as that used by
-// indy-switch. For example:
-//
-//	{
-//	  "1":  ["6:53 AM", "6:03 PM"],
-//	  "2":  ["6:46 AM", "6:20 PM"],
-//	  "3":  ["6:26 AM", "6:29 PM"],
-//	  "4":  ["6:02 AM", "6:36 PM"],
-//	  "5":  ["5:45 AM", "6:45 PM"],
-//	  "6":  ["5:43 AM", "6:56 PM"],
-//	  "7":  ["5:51 AM", "6:58 PM"],
-//	  "8":  ["6:01 AM", "6:45 PM"],
-//	  "9":  ["6:07 AM", "6:20 PM"],
-//	  "10": ["6:12 AM", "5:57 PM"],
-//	  "11": ["6:25 AM", "5:42 PM"],
-//	  "12": ["6:42 AM", "5:46 PM"]
-//	}
-func readSuntimes(filename string) (*map[int][2]string, error) {
-	// Open file
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("unable to open '%s': %v", filename, err)
-	}
-	defer file.Close()
-
-	// Parse file
-	var suntimes map[int][2]string
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&suntimes); err != nil {
-		return nil, fmt.Errorf("unable to parse JSON: %v", err)
-	}
-
-	return &suntimes, nil
-}
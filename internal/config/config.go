@@ -2,80 +2,241 @@
 package config
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"indy-mqtt/internal/util"
 )
 
 // configRegular holds config values read from the file config.json.
 type configRegular struct {
+	Scheme   *string `json:"scheme"` // One of tcp, ssl, ws, or wss. Defaults to ssl.
 	Hostname *string `json:"hostname"`
 	Port     *int    `json:"port"`
+	Path     *string `json:"path"` // URL path for ws and wss, such as /mqtt.
+
+	// TLS settings, used with the ssl and wss schemes.
+	CAFile             *string `json:"ca_file"`              // PEM file of CAs to trust instead of the system's
+	CertFile           *string `json:"cert_file"`            // PEM client certificate, for mutual TLS
+	KeyFile            *string `json:"key_file"`             // PEM private key for cert_file
+	ServerName         *string `json:"server_name"`          // Name to verify the broker's certificate against
+	MinTLSVersion      *string `json:"min_tls_version"`      // One of 1.0, 1.1, 1.2, or 1.3
+	InsecureSkipVerify *bool   `json:"insecure_skip_verify"` // Skip certificate verification (lab use only)
+
+	// Timeouts. See Timeouts for defaults.
+	ConnectTimeout *Duration `json:"connect_timeout"` // Connecting, writing, and subscribing
+	AckTimeout     *Duration `json:"ack_timeout"`     // Waiting for an ACK
+	KeepAlive      *Duration `json:"keepalive"`       // Interval between keepalive messages
+}
+
+// DEFAULT_SCHEME is the broker URL scheme used when none is configured.
+const DEFAULT_SCHEME = "ssl"
+
+// schemes maps each supported broker URL scheme to the port conventionally
+// used with it.
+var schemes = map[string]int{
+	"tcp": 1883,
+	"ssl": 8883,
+	"ws":  80,
+	"wss": 443,
+}
+
+// IsSecureScheme returns whether `scheme` uses TLS.
+func IsSecureScheme(scheme string) bool {
+	return scheme == "ssl" || scheme == "wss"
 }
 
 // configSecrets holds config values read from the file config-secrets.json.
 type configSecrets struct {
 	Username *string `json:"username"`
-	Password *string `json:"password"`
+
+	// The password is read from the first of these that's set. See
+	// passwordProvider.
+	Password        *string `json:"password"`
+	PasswordFile    *string `json:"password_file"`
+	PasswordCommand *string `json:"password_command"`
 }
 
 // Config holds all config values.
 type Config struct {
 	configRegular
 	configSecrets
+	Profile string      // Name of the profile used, or empty if none
+	Devices Inventory   // Known switches, by alias
+	Groups  Groups      // Named groups of switches
+	TLS     *tls.Config // TLS configuration for the broker, or nil if the scheme doesn't use TLS
 }
 
 // checkFields checks that the fields in `config` are set.
-func (config configRegular) checkFields(path string) {
+func (config *configRegular) checkFields(path string) {
 	if config.Hostname == nil {
-		util.ERROR.Fatalf("hostname not found in '%s'", path)
+		util.FatalExitf(util.EXIT_CONFIG, "hostname not found in '%s'", path)
 	}
 	if config.Port == nil {
-		util.ERROR.Fatalf("port not found in '%s'", path)
+		util.FatalExitf(util.EXIT_CONFIG, "port not found in '%s'", path)
+	}
+	if config.Scheme == nil {
+		scheme := DEFAULT_SCHEME
+		config.Scheme = &scheme
+	}
+	if err := checkSchemeAndPort(*config.Scheme, *config.Port, config.Path); err != nil {
+		util.FatalExitf(util.EXIT_CONFIG, "%v in '%s'", err, path)
+	}
+	if err := config.checkTLSFields(); err != nil {
+		util.FatalExitf(util.EXIT_CONFIG, "%v in '%s'", err, path)
+	}
+	if err := config.checkTimeouts(); err != nil {
+		util.FatalExitf(util.EXIT_CONFIG, "%v in '%s'", err, path)
 	}
 }
 
+// checkSchemeAndPort checks that `scheme` is supported, that `port` is a
+// valid port number, and that `path` is only given for websocket schemes.
+// A warning is printed when a scheme is paired with the port conventionally
+// used by a different scheme, since that usually means one of the two was
+// mistyped.
+func checkSchemeAndPort(scheme string, port int, path *string) error {
+	// Is the scheme supported?
+	defaultPort, ok := schemes[scheme]
+	if !ok {
+		return fmt.Errorf("unknown scheme '%s' (expected tcp, ssl, ws, or wss)", scheme)
+	}
+
+	// Is the port valid?
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port %d is out of range (expected 1 to 65535)", port)
+	}
+
+	// Does the port belong to a different scheme?
+	if port != defaultPort {
+		for otherScheme, otherPort := range schemes {
+			if otherScheme != scheme && otherPort == port {
+				util.WARNING.Printf("Port %d is normally used with %s rather than %s", port, otherScheme, scheme)
+			}
+		}
+	}
+
+	// Is a path only given for websockets?
+	if path != nil && scheme != "ws" && scheme != "wss" {
+		return fmt.Errorf("path is only supported with the ws and wss schemes")
+	}
+
+	return nil
+}
+
+// BrokerURL returns the URL of the MQTT broker, such as ssl://example.com:8883.
+func (config Config) BrokerURL() string {
+	url := fmt.Sprintf("%s://%s:%d", *config.Scheme, *config.Hostname, *config.Port)
+	if config.Path != nil {
+		url += "/" + strings.TrimPrefix(*config.Path, "/")
+	}
+	return url
+}
+
 // checkFields checks that the fields in `config` are set.
 func (config configSecrets) checkFields(path string) {
 	if config.Username == nil {
-		util.ERROR.Fatalf("username not found in '%s'", path)
+		util.FatalExitf(util.EXIT_CONFIG, "username not found in '%s' or %s", path, envVarName("username"))
 	}
-	if config.Password == nil {
-		util.ERROR.Fatalf("password not found in '%s'", path)
+	if !config.hasPasswordSource() && !isStdinTerminal() {
+		util.FatalExitf(util.EXIT_CONFIG, "password, password_file, or password_command not found in '%s' or %s",
+			path, envVarName("password"))
 	}
 }
 
-// LoadConfig reads and parses the JSON config file at `path` and returns the
-// results in `dest`.
-func loadConfig(path string, dest any) {
+// loadConfig reads and parses the JSON config file at `path` and returns the
+// results in `dest`. If `optional` is true a missing file is skipped, and
+// otherwise it's an error. Returns whether the file was read.
+func loadConfig(path string, dest any, optional bool) bool {
 	// Read config file
 	bytes, err := os.ReadFile(path)
+	if optional && errors.Is(err, os.ErrNotExist) {
+		util.INFO.Printf("Config file '%s' not found", path)
+		return false
+	}
 	if err != nil {
-		util.ERROR.Fatalf("Failed to read config file '%s': %v", path, err)
+		util.FatalExitf(util.EXIT_CONFIG, "Failed to read config file '%s': %v", path, err)
 	}
 
 	// Parse config file
 	err = json.Unmarshal(bytes, &dest)
 	if err != nil {
-		util.ERROR.Fatalf("Failed to unmarshal config file '%s': %v", path, err)
+		util.FatalExitf(util.EXIT_CONFIG, "Failed to unmarshal config file '%s': %v", path, err)
 	}
+
+	return true
 }
 
 // LoadConfig returns a Config struct that contains the config values read from
-// the files config.json and config-secrets.json.
-func LoadConfig() *Config {
+// the files config.json and config-secrets.json. If `path` isn't empty it's
+// the path to config.json, and otherwise config.json is searched for as
+// described by FindConfig. config-secrets.json is read from the same
+// directory as config.json, and is optional when its values are given by
+// environment variables instead. Any config value can be overridden with an
+// environment variable, as described by applyEnvOverrides.
+//
+// If `profile` isn't empty, the values of the named profile override the
+// shared values in both files. Otherwise the default profile is used, if
+// config.json names one.
+func LoadConfig(path string, profile string) *Config {
+	// Find config.json
+	var err error
+	if path == "" {
+		if path, err = FindConfig(); err != nil {
+			util.FatalExitf(util.EXIT_CONFIG, "%v", err)
+		}
+	}
+	util.INFO.Printf("Using config file '%s'", path)
+
 	// Load config.json
-	var config1 configRegular
-	path := "internal/config/config.json"
-	loadConfig(path, &config1)
+	var file1 regularFile
+	loadConfig(path, &file1, false)
+	profile, err = file1.selectProfile(profile, path)
+	if err != nil {
+		util.FatalExitf(util.EXIT_CONFIG, "%v", err)
+	}
+	config1 := file1.configRegular
+	if profile != "" {
+		util.INFO.Printf("Using profile '%s'", profile)
+		mergeFields(&config1, file1.Profiles[profile])
+	}
+	if err := applyEnvOverrides(&config1); err != nil {
+		util.FatalExitf(util.EXIT_CONFIG, "%v", err)
+	}
 	config1.checkFields(path)
+	file1.Devices.checkDevices(path)
 
 	// Load config-secrets.json
-	var config2 configSecrets
-	path = "internal/config/config-secrets.json"
-	loadConfig(path, &config2)
+	regularPath := path
+	var file2 secretsFile
+	path = filepath.Join(filepath.Dir(path), SECRETS_FILE_NAME)
+	if loadConfig(path, &file2, true) {
+		util.INFO.Printf("Using secrets file '%s'", path)
+	}
+	config2 := file2.configSecrets
+	if secrets, ok := file2.Profiles[profile]; ok && profile != "" {
+		config2.mergeSecrets(secrets)
+	}
+	var envSecrets configSecrets
+	if err := applyEnvOverrides(&envSecrets); err != nil {
+		util.FatalExitf(util.EXIT_CONFIG, "%v", err)
+	}
+	config2.mergeSecrets(envSecrets)
 	config2.checkFields(path)
 
-	return &Config{configRegular: config1, configSecrets: config2}
+	config := &Config{configRegular: config1, configSecrets: config2, Profile: profile,
+		Devices: file1.Devices, Groups: file1.Groups}
+	config.checkGroups(regularPath)
+
+	// Load TLS files
+	if config.TLS, err = config.loadTLSConfig(); err != nil {
+		util.FatalExitf(util.EXIT_CONFIG, "%v", err)
+	}
+
+	return config
 }
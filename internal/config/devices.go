@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"indy-mqtt/internal/util"
+)
+
+// Device holds the inventory entry for a switch.
+type Device struct {
+	ID       string `json:"id"`       // Device ID used in MQTT topics, such as esp-vorona
+	Location string `json:"location"` // Where the switch is, for reference
+	Timezone string `json:"timezone"` // Timezone the switch is expected to be configured with
+	Firmware string `json:"firmware"` // Firmware version the switch is expected to run
+}
+
+// Inventory maps device aliases, such as "porch", to devices.
+type Inventory map[string]Device
+
+// MAX_SUGGESTION_DISTANCE is the largest edit distance between an unknown
+// device name and a known one for the known one to be suggested.
+const MAX_SUGGESTION_DISTANCE = 2
+
+// Aliases returns the sorted aliases in the inventory.
+func (inventory Inventory) Aliases() []string {
+	aliases := make([]string, 0, len(inventory))
+	for alias := range inventory {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// Lookup returns the device that `name` refers to, where `name` is either an
+// alias or a device ID. If `name` isn't in the inventory, a device with just
+// its ID set to `name` is returned, so that switches not in the inventory can
+// still be used. A warning is printed if `name` is close to a known alias or
+// ID, since it may then be a typo.
+func (inventory Inventory) Lookup(name string) Device {
+	// Is this an alias?
+	if device, ok := inventory[name]; ok {
+		return device
+	}
+
+	// Is this a device ID?
+	for _, alias := range inventory.Aliases() {
+		if device := inventory[alias]; device.ID == name {
+			return device
+		}
+	}
+
+	// Is this close to a known name?
+	if suggestion := inventory.suggest(name); suggestion != "" {
+		util.WARNING.Printf("Device '%s' isn't in the inventory; did you mean '%s'?", name, suggestion)
+	}
+
+	return Device{ID: name}
+}
+
+// resolveName returns the devices that `name` refers to, where `name` is
+// either an alias or device ID, as accepted by Lookup, or a glob pattern such
+// as "esp-*" that's matched against the aliases and device IDs in the
+// inventory.
+func (inventory Inventory) resolveName(name string) ([]Device, error) {
+	// Is this a glob pattern?
+	if strings.ContainsAny(name, "*?[") {
+		return inventory.match(name)
+	}
+
+	// Look up single device
+	return []Device{inventory.Lookup(name)}, nil
+}
+
+// match returns the devices whose alias or device ID matches the glob
+// `pattern`, sorted by alias.
+func (inventory Inventory) match(pattern string) ([]Device, error) {
+	var devices []Device
+	for _, alias := range inventory.Aliases() {
+		device := inventory[alias]
+		aliasMatched, err := path.Match(pattern, alias)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host pattern '%s': %v", pattern, err)
+		}
+		idMatched, _ := path.Match(pattern, device.ID)
+		if aliasMatched || idMatched {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no devices in inventory match '%s'", pattern)
+	}
+	return devices, nil
+}
+
+// suggest returns the known alias or device ID closest to `name`, or an empty
+// string if none is close enough.
+func (inventory Inventory) suggest(name string) string {
+	var candidates []string
+	for _, alias := range inventory.Aliases() {
+		candidates = append(candidates, alias, inventory[alias].ID)
+	}
+	return closest(name, candidates)
+}
+
+// closest returns the first of `candidates` with the smallest edit distance
+// from `name`, or an empty string if none is within MAX_SUGGESTION_DISTANCE.
+func closest(name string, candidates []string) string {
+	best := ""
+	bestDistance := MAX_SUGGESTION_DISTANCE + 1
+	for _, candidate := range candidates {
+		if distance := util.EditDistance(name, candidate); distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// checkDevices checks that each device in `inventory` has an ID.
+func (inventory Inventory) checkDevices(path string) {
+	for alias, device := range inventory {
+		if device.ID == "" {
+			util.FatalExitf(util.EXIT_CONFIG, "id not found for device '%s' in '%s'", alias, path)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"indy-mqtt/internal/util"
+)
+
+// ENV_PREFIX is the prefix of the environment variables that override config
+// file values. The variable for each field is the prefix followed by the
+// field's JSON name in upper case, such as INDY_MQTT_HOSTNAME.
+const ENV_PREFIX = "INDY_MQTT_"
+
+// envVarName returns the environment variable that overrides the field with
+// JSON name `jsonName`.
+func envVarName(jsonName string) string {
+	return ENV_PREFIX + strings.ToUpper(jsonName)
+}
+
+// applyEnvOverrides sets fields in `dest`, a pointer to a struct of pointer
+// fields with JSON tags, from any matching environment variables that are
+// set.
+func applyEnvOverrides(dest any) error {
+	value := reflect.ValueOf(dest).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		// Is the environment variable for this field set?
+		field := value.Type().Field(i)
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if jsonName == "" || jsonName == "-" {
+			continue
+		}
+		name := envVarName(jsonName)
+		str, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		util.INFO.Printf("Using %s from %s", jsonName, name)
+
+		// Parse value
+		var parsed any
+		switch field.Type.Elem().Kind() {
+		case reflect.String:
+			parsed = str
+		case reflect.Int64:
+			if field.Type.Elem() != reflect.TypeOf(Duration(0)) {
+				return fmt.Errorf("%s can't be set from the environment", name)
+			}
+			duration, err := ParseDuration(str)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			parsed = duration
+		case reflect.Int:
+			num, err := strconv.Atoi(str)
+			if err != nil {
+				return fmt.Errorf("%s needs to be an integer instead of '%s'", name, str)
+			}
+			parsed = num
+		case reflect.Bool:
+			flag, err := strconv.ParseBool(str)
+			if err != nil {
+				return fmt.Errorf("%s needs to be true or false instead of '%s'", name, str)
+			}
+			parsed = flag
+		default:
+			return fmt.Errorf("%s can't be set from the environment", name)
+		}
+
+		// Set field
+		ptr := reflect.New(field.Type.Elem())
+		ptr.Elem().Set(reflect.ValueOf(parsed))
+		value.Field(i).Set(ptr)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"indy-mqtt/internal/util"
+)
+
+// Names of the config files.
+const CONFIG_FILE_NAME = "config.json"
+const SECRETS_FILE_NAME = "config-secrets.json"
+
+// CONFIG_ENV_VAR names the environment variable that can hold the path to
+// config.json.
+const CONFIG_ENV_VAR = "INDY_MQTT_CONFIG"
+
+// configDirs returns the directories searched for config.json, in order of
+// preference.
+func configDirs() []string {
+	var dirs []string
+	if xdgHome := os.Getenv("XDG_CONFIG_HOME"); xdgHome != "" {
+		dirs = append(dirs, filepath.Join(xdgHome, "indy-mqtt"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "indy-mqtt"))
+	}
+	dirs = append(dirs, "/etc/indy-mqtt")
+
+	// Fall back to the source checkout, for running from there
+	dirs = append(dirs, filepath.Join("internal", "config"))
+
+	return dirs
+}
+
+// FindConfig returns the path to config.json. The path is taken from the
+// INDY_MQTT_CONFIG environment variable if it's set, and otherwise these
+// directories are searched in order:
+//
+//	$XDG_CONFIG_HOME/indy-mqtt/
+//	~/.config/indy-mqtt/
+//	/etc/indy-mqtt/
+//	internal/config/ (relative to the current directory)
+func FindConfig() (string, error) {
+	// Use environment variable if set
+	if path := os.Getenv(CONFIG_ENV_VAR); path != "" {
+		util.INFO.Printf("Using config file from %s", CONFIG_ENV_VAR)
+		return path, nil
+	}
+
+	// Search config directories
+	dirs := configDirs()
+	for _, dir := range dirs {
+		path := filepath.Join(dir, CONFIG_FILE_NAME)
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("unable to access config file '%s': %v", path, err)
+		}
+		util.INFO.Printf("Config file '%s' not found", path)
+	}
+
+	return "", fmt.Errorf("%s not found in any of: %s (use -config or %s to specify it)",
+		CONFIG_FILE_NAME, strings.Join(dirs, ", "), CONFIG_ENV_VAR)
+}
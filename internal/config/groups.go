@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"indy-mqtt/internal/util"
+)
+
+// Groups maps group names, such as "exterior", to their members. Each member
+// is anything accepted as a host: an alias, device ID, glob pattern, or
+// another group prefixed with GROUP_PREFIX.
+type Groups map[string][]string
+
+// GROUP_PREFIX marks a host name as a group name, as in "@exterior".
+const GROUP_PREFIX = "@"
+
+// ALL_GROUP names the built-in group of every device in the inventory. It can
+// be redefined in the config file.
+const ALL_GROUP = "all"
+
+// Names returns the sorted group names.
+func (groups Groups) Names() []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the devices that `spec` refers to, where `spec` is a
+// comma-separated list of hosts. Each host is an alias, device ID, or glob
+// pattern, as accepted by Inventory.Lookup and Inventory.match, or a group
+// name prefixed with GROUP_PREFIX. Groups are resolved recursively. Devices
+// are returned in the order given, without duplicates. An error is returned if
+// no devices are found, such as for an empty group.
+func (config Config) Resolve(spec string) ([]Device, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("empty host name in '%s'", spec)
+		}
+		names = append(names, name)
+	}
+	devices, err := config.resolveNames(names, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("'%s' has no devices", spec)
+	}
+	return devices, nil
+}
+
+// resolveNames returns the devices that the hosts in `names` refer to, without
+// duplicates. `stack` holds the groups currently being resolved, to detect
+// cycles.
+func (config Config) resolveNames(names []string, stack []string) ([]Device, error) {
+	var devices []Device
+	seen := make(map[string]bool)
+	for _, name := range names {
+		// Resolve name
+		var resolved []Device
+		var err error
+		if group, ok := strings.CutPrefix(name, GROUP_PREFIX); ok {
+			resolved, err = config.resolveGroup(group, stack)
+		} else {
+			resolved, err = config.Devices.resolveName(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Add devices not seen yet
+		for _, device := range resolved {
+			if !seen[device.ID] {
+				seen[device.ID] = true
+				devices = append(devices, device)
+			}
+		}
+	}
+
+	return devices, nil
+}
+
+// ResolveGroup returns the devices in group `group`, given without
+// GROUP_PREFIX.
+func (config Config) ResolveGroup(group string) ([]Device, error) {
+	return config.resolveGroup(group, nil)
+}
+
+// resolveGroup returns the devices in group `group`. `stack` holds the groups
+// currently being resolved, to detect cycles.
+func (config Config) resolveGroup(group string, stack []string) ([]Device, error) {
+	// Is this a cycle?
+	for i, name := range stack {
+		if name == group {
+			cycle := append(append([]string{}, stack[i:]...), group)
+			return nil, fmt.Errorf("group cycle: %s%s", GROUP_PREFIX, strings.Join(cycle, " -> "+GROUP_PREFIX))
+		}
+	}
+
+	// Is this a known group?
+	members, ok := config.Groups[group]
+	if !ok && group == ALL_GROUP {
+		return config.Devices.match("*")
+	}
+	if !ok {
+		if best := closest(group, config.Groups.Names()); best != "" {
+			return nil, fmt.Errorf("unknown group '%s%s'; did you mean '%s%s'?", GROUP_PREFIX, group, GROUP_PREFIX, best)
+		}
+		return nil, fmt.Errorf("unknown group '%s%s'", GROUP_PREFIX, group)
+	}
+
+	return config.resolveNames(members, append(stack, group))
+}
+
+// checkGroups checks that each group in `config` can be resolved.
+func (config Config) checkGroups(path string) {
+	for _, name := range config.Groups.Names() {
+		if _, err := config.ResolveGroup(name); err != nil {
+			util.FatalExitf(util.EXIT_CONFIG, "Invalid group '%s' in '%s': %v", name, path, err)
+		}
+	}
+}
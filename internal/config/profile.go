@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// regularFile holds the contents of config.json: shared config values, plus
+// any named profiles whose values override them.
+type regularFile struct {
+	configRegular
+	DefaultProfile *string                  `json:"default_profile"`
+	Profiles       map[string]configRegular `json:"profiles"`
+	Devices        Inventory                `json:"devices"`
+	Groups         Groups                   `json:"groups"`
+}
+
+// secretsFile holds the contents of config-secrets.json: shared credentials,
+// plus any per-profile credentials that override them.
+type secretsFile struct {
+	configSecrets
+	Profiles map[string]configSecrets `json:"profiles"`
+}
+
+// mergeFields copies each non-nil pointer field of `src` into `dest`, where
+// `dest` is a pointer to a struct of the same type as `src`.
+func mergeFields(dest any, src any) {
+	destValue := reflect.ValueOf(dest).Elem()
+	srcValue := reflect.ValueOf(src)
+	for i := 0; i < srcValue.NumField(); i++ {
+		field := srcValue.Field(i)
+		if field.Kind() == reflect.Pointer && !field.IsNil() {
+			destValue.Field(i).Set(field)
+		}
+	}
+}
+
+// profileNames returns the sorted names of the profiles in `profiles`.
+func profileNames(profiles map[string]configRegular) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectProfile returns the name of the profile to use from `file`, given the
+// profile `requested` by the user. The requested profile is used if given,
+// and otherwise the file's default profile if it has one. An empty name means
+// no profile is used.
+func (file regularFile) selectProfile(requested string, path string) (string, error) {
+	name := requested
+	if name == "" && file.DefaultProfile != nil {
+		name = *file.DefaultProfile
+	}
+	if name == "" {
+		return "", nil
+	}
+	if _, ok := file.Profiles[name]; !ok {
+		names := profileNames(file.Profiles)
+		if len(names) == 0 {
+			return "", fmt.Errorf("profile '%s' not found in '%s', which has no profiles", name, path)
+		}
+		return "", fmt.Errorf("profile '%s' not found in '%s' (available profiles: %s)",
+			name, path, strings.Join(names, ", "))
+	}
+	return name, nil
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"indy-mqtt/internal/util"
+)
+
+// SecretProvider is implemented by each source a secret such as the broker
+// password can be read from.
+type SecretProvider interface {
+	// Description returns a short description of the source, for messages.
+	Description() string
+
+	// Secret returns the secret.
+	Secret() (string, error)
+}
+
+// literalSecret implements SecretProvider for a secret given directly in a
+// config file or environment variable.
+type literalSecret struct {
+	value string
+}
+
+func (provider literalSecret) Description() string {
+	return "config value password"
+}
+
+func (provider literalSecret) Secret() (string, error) {
+	return provider.value, nil
+}
+
+// fileSecret implements SecretProvider for a secret read from a file. Trailing
+// newlines are removed.
+type fileSecret struct {
+	path string
+}
+
+func (provider fileSecret) Description() string {
+	return fmt.Sprintf("password_file '%s'", provider.path)
+}
+
+func (provider fileSecret) Secret() (string, error) {
+	bytes, err := os.ReadFile(provider.path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read password file: %v", err)
+	}
+	return strings.TrimRight(string(bytes), "\r\n"), nil
+}
+
+// commandSecret implements SecretProvider for a secret written to stdout by a
+// shell command, such as `pass show mqtt/indy`. Only the first line of output
+// is used.
+type commandSecret struct {
+	command string
+}
+
+func (provider commandSecret) Description() string {
+	return fmt.Sprintf("password_command '%s'", provider.command)
+}
+
+func (provider commandSecret) Secret() (string, error) {
+	cmd := exec.Command("sh", "-c", provider.command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("password command failed: %v", err)
+	}
+	line, _, _ := bytes.Cut(output, []byte("\n"))
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+// promptSecret implements SecretProvider for a secret typed by the user at the
+// terminal. Echo is turned off while the secret is typed.
+type promptSecret struct {
+	prompt string
+}
+
+func (provider promptSecret) Description() string {
+	return "terminal prompt"
+}
+
+func (provider promptSecret) Secret() (string, error) {
+	// Turn off echo
+	if err := stty("-echo"); err != nil {
+		util.WARNING.Printf("Unable to turn off echo: %v", err)
+	} else {
+		defer func() {
+			if err := stty("echo"); err != nil {
+				util.WARNING.Printf("Unable to turn echo back on: %v", err)
+			}
+		}()
+	}
+
+	// Read secret
+	fmt.Fprint(os.Stderr, provider.prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("unable to read password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// stty runs stty with `arg` on the terminal attached to stdin.
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// isStdinTerminal returns whether stdin is a terminal. Character devices such
+// as /dev/null are ruled out by checking that stty can read their settings.
+func isStdinTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	return stty("-g") == nil
+}
+
+// hasPasswordSource returns whether any of password, password_file, and
+// password_command is set.
+func (config configSecrets) hasPasswordSource() bool {
+	return config.Password != nil || config.PasswordFile != nil || config.PasswordCommand != nil
+}
+
+// mergeSecrets overrides the fields of `config` with those set in `override`,
+// as mergeFields does, except that a password source set in `override`
+// replaces every password source in `config`. That way a profile with its own
+// password_file isn't overridden by a shared password.
+func (config *configSecrets) mergeSecrets(override configSecrets) {
+	if override.hasPasswordSource() {
+		config.Password, config.PasswordFile, config.PasswordCommand = nil, nil, nil
+	}
+	mergeFields(config, override)
+}
+
+// passwordProvider returns the provider for the broker password. The first of
+// password, password_file, and password_command that's set is used. If none
+// are set the user is prompted when stdin is a terminal, and otherwise nil is
+// returned.
+func (config configSecrets) passwordProvider(hostname string) SecretProvider {
+	switch {
+	case config.Password != nil:
+		return literalSecret{value: *config.Password}
+	case config.PasswordFile != nil:
+		return fileSecret{path: *config.PasswordFile}
+	case config.PasswordCommand != nil:
+		return commandSecret{command: *config.PasswordCommand}
+	case isStdinTerminal():
+		prompt := fmt.Sprintf("Password for '%s' on '%s': ", *config.Username, hostname)
+		return promptSecret{prompt: prompt}
+	default:
+		return nil
+	}
+}
+
+// ResolvePassword sets the password from the source given by
+// passwordProvider. This is done only when connecting to the broker, so that
+// commands that don't connect don't prompt for it.
+func (config *Config) ResolvePassword() {
+	provider := config.passwordProvider(*config.Hostname)
+	password, err := provider.Secret()
+	if err != nil {
+		util.FatalExitf(util.EXIT_CONFIG, "Unable to get password from %s: %v", provider.Description(), err)
+	}
+	util.INFO.Printf("Using password from %s", provider.Description())
+	config.Password = &password
+}
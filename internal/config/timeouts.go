@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Default timeouts.
+const DEFAULT_CONNECT_TIMEOUT = 30 * time.Second
+const DEFAULT_ACK_TIMEOUT = 30 * time.Second
+const DEFAULT_KEEPALIVE = 10 * time.Second
+
+// MIN_KEEPALIVE is the shortest keepalive interval. The keepalive is sent to the
+// broker in whole seconds, so a shorter one would disable keepalives.
+const MIN_KEEPALIVE = time.Second
+
+// Duration is a time.Duration that's configured either as a string such as
+// "45s" or "2m", or as a number of seconds.
+type Duration time.Duration
+
+// ParseDuration parses `str` as a Duration, either in the format accepted by
+// time.ParseDuration or as a number of seconds. The duration needs to be
+// positive.
+func ParseDuration(str string) (Duration, error) {
+	duration, err := time.ParseDuration(str)
+	if err != nil {
+		seconds, parseErr := strconv.ParseFloat(str, 64)
+		if parseErr != nil {
+			return 0, fmt.Errorf("invalid duration '%s' (expected a duration such as 45s or 2m)", str)
+		}
+		duration = time.Duration(seconds * float64(time.Second))
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("duration '%s' needs to be positive", str)
+	}
+	return Duration(duration), nil
+}
+
+// UnmarshalJSON parses a Duration from a JSON string or number of seconds.
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	var err error
+	switch value := value.(type) {
+	case string:
+		*duration, err = ParseDuration(value)
+	case float64:
+		*duration, err = ParseDuration(fmt.Sprintf("%gs", value))
+	default:
+		err = fmt.Errorf("invalid duration %s (expected a string or number of seconds)", data)
+	}
+	return err
+}
+
+// Timeouts holds the timeouts used when talking to the broker.
+type Timeouts struct {
+	Connect   time.Duration // Connecting, writing, and subscribing
+	Ack       time.Duration // Waiting for an ACK
+	KeepAlive time.Duration // Interval between keepalive messages
+}
+
+// checkTimeouts checks that the timeouts in `config` are usable.
+func (config configRegular) checkTimeouts() error {
+	if config.KeepAlive != nil && time.Duration(*config.KeepAlive) < MIN_KEEPALIVE {
+		return fmt.Errorf("keepalive needs to be at least %v", MIN_KEEPALIVE)
+	}
+	return nil
+}
+
+// Timeouts returns the configured timeouts, with defaults for those not set.
+func (config Config) Timeouts() Timeouts {
+	timeouts := Timeouts{Connect: DEFAULT_CONNECT_TIMEOUT, Ack: DEFAULT_ACK_TIMEOUT, KeepAlive: DEFAULT_KEEPALIVE}
+	if config.ConnectTimeout != nil {
+		timeouts.Connect = time.Duration(*config.ConnectTimeout)
+	}
+	if config.AckTimeout != nil {
+		timeouts.Ack = time.Duration(*config.AckTimeout)
+	}
+	if config.KeepAlive != nil {
+		timeouts.KeepAlive = time.Duration(*config.KeepAlive)
+	}
+	return timeouts
+}
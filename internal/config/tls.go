@@ -0,0 +1,101 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"indy-mqtt/internal/util"
+)
+
+// tlsVersions maps the values accepted for min_tls_version to their crypto/tls
+// constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// hasTLSFields returns whether any of the TLS fields in `config` are set.
+func (config configRegular) hasTLSFields() bool {
+	return config.CAFile != nil || config.CertFile != nil || config.KeyFile != nil ||
+		config.ServerName != nil || config.MinTLSVersion != nil || config.InsecureSkipVerify != nil
+}
+
+// checkTLSFields checks that the TLS fields in `config` are consistent with
+// each other and with the scheme.
+func (config configRegular) checkTLSFields() error {
+	// Are TLS fields only given for TLS schemes?
+	if config.hasTLSFields() && !IsSecureScheme(*config.Scheme) {
+		return fmt.Errorf("TLS settings are only supported with the ssl and wss schemes")
+	}
+
+	// Are the client certificate and key given together?
+	if (config.CertFile == nil) != (config.KeyFile == nil) {
+		return fmt.Errorf("cert_file and key_file need to be given together")
+	}
+
+	// Is the TLS version recognized?
+	if config.MinTLSVersion != nil {
+		if _, ok := tlsVersions[*config.MinTLSVersion]; !ok {
+			return fmt.Errorf("unrecognized min_tls_version '%s' (expected 1.0, 1.1, 1.2, or 1.3)", *config.MinTLSVersion)
+		}
+	}
+
+	return nil
+}
+
+// loadTLSConfig returns the TLS configuration to use when connecting to the
+// broker, or nil if the scheme doesn't use TLS. An error is returned if the CA
+// or client certificate files can't be read, or if the client key doesn't
+// match the client certificate.
+func (config Config) loadTLSConfig() (*tls.Config, error) {
+	if !IsSecureScheme(*config.Scheme) {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	// Load CA bundle
+	if config.CAFile != nil {
+		pemBytes, err := os.ReadFile(*config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file '%s': %v", *config.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("no PEM certificates found in CA file '%s'", *config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Load client certificate
+	if config.CertFile != nil {
+		for _, path := range []string{*config.CertFile, *config.KeyFile} {
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf("unable to read client certificate file '%s': %v", path, err)
+			}
+		}
+		cert, err := tls.LoadX509KeyPair(*config.CertFile, *config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate '%s' with key '%s' (does the key match the certificate?): %v",
+				*config.CertFile, *config.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// Set remaining options
+	if config.ServerName != nil {
+		tlsConfig.ServerName = *config.ServerName
+	}
+	if config.MinTLSVersion != nil {
+		tlsConfig.MinVersion = tlsVersions[*config.MinTLSVersion]
+	}
+	if config.InsecureSkipVerify != nil && *config.InsecureSkipVerify {
+		util.WARNING.Printf("TLS certificate verification is disabled")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return tlsConfig, nil
+}
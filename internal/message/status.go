@@ -0,0 +1,313 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// STATUS_TIME_LAYOUT is the layout of the times in StatusContent, such as
+// "Wed Jan 17 10:57:55 2024 CST". The switch reports only a timezone
+// abbreviation, so parsed times keep the abbreviation but, unless the
+// abbreviation is known locally, have a UTC offset of zero. Output always uses
+// the times as the switch reported them, rather than the parsed times.
+const STATUS_TIME_LAYOUT = "Mon Jan _2 15:04:05 2006 MST"
+
+// STATUS_TIME_LAYOUT_NUMERIC is the layout of the times in StatusContent for
+// timezones whose abbreviation is a numeric offset, such as
+// "Wed Jan 17 10:57:55 2024 +0330".
+const STATUS_TIME_LAYOUT_NUMERIC = "Mon Jan _2 15:04:05 2006 -0700"
+
+// Status field names, in the order they're reported.
+const (
+	FIELD_DEVICE           = "device"
+	FIELD_FIRMWARE         = "firmware"
+	FIELD_DATE             = "date"
+	FIELD_IS_ON            = "is_on"
+	FIELD_SUNRISE          = "sunrise"
+	FIELD_SUNSET           = "sunset"
+	FIELD_OFFSET           = "offset"
+	FIELD_NEXT_ACTION      = "next_action"
+	FIELD_NEXT_ACTION_TIME = "next_action_time"
+	FIELD_SUNTIMES         = "suntimes"
+)
+
+// StatusFields lists the status field names, in the order they're reported.
+var StatusFields = []string{FIELD_DEVICE, FIELD_FIRMWARE, FIELD_DATE, FIELD_IS_ON, FIELD_SUNRISE,
+	FIELD_SUNSET, FIELD_OFFSET, FIELD_NEXT_ACTION, FIELD_NEXT_ACTION_TIME, FIELD_SUNTIMES}
+
+// Action is the next action a switch will take.
+type Action string
+
+// Actions.
+const (
+	ACTION_ON  Action = "ON"
+	ACTION_OFF Action = "OFF"
+)
+
+// ParseAction returns the Action named by `name`.
+func ParseAction(name string) (Action, error) {
+	switch action := Action(name); action {
+	case ACTION_ON, ACTION_OFF:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unrecognized action '%s' (expected ON or OFF)", name)
+	}
+}
+
+// Suntimes maps months (1 to 12) to their sunrise and sunset times, such as
+// ["6:53 AM", "6:03 PM"].
+type Suntimes map[int][2]string
+
+// Months returns the sorted months in `suntimes`.
+func (suntimes Suntimes) Months() []int {
+	months := make([]int, 0, len(suntimes))
+	for month := range suntimes {
+		months = append(months, month)
+	}
+	sort.Ints(months)
+	return months
+}
+
+// String returns a one-line representation of `suntimes`.
+func (suntimes Suntimes) String() string {
+	var builder strings.Builder
+	for i, month := range suntimes.Months() {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		times := suntimes[month]
+		builder.WriteString(fmt.Sprintf("%d: [\"%s\", \"%s\"]", month, times[0], times[1]))
+	}
+	return builder.String()
+}
+
+// StatusContent is the ACK content for the get status command. Only the fields
+// the switch reported are set, as returned by Has. Fields not recognized, such
+// as those added by newer firmware, are kept in Unknown. Times that can't be
+// parsed are left as the zero time, and reported by Warnings.
+type StatusContent struct {
+	Device         string
+	Firmware       string
+	Date           time.Time
+	IsOn           bool
+	Sunrise        time.Time
+	Sunset         time.Time
+	Offset         int
+	NextAction     Action
+	NextActionTime time.Time
+	Suntimes       Suntimes
+	Unknown        map[string]json.RawMessage
+
+	present  map[string]bool   // Fields the switch reported
+	times    map[string]string // Time fields as the switch reported them
+	warnings []error           // Problems with fields that were kept anyway
+}
+
+// Warnings returns the problems found with fields that were still reported,
+// such as times that couldn't be parsed.
+func (status StatusContent) Warnings() []error {
+	return status.warnings
+}
+
+// Has returns whether the switch reported status field `field`.
+func (status StatusContent) Has(field string) bool {
+	return status.present[field]
+}
+
+// UnmarshalJSON parses status content. An error is returned that lists every
+// malformed field.
+func (status *StatusContent) UnmarshalJSON(data []byte) error {
+	// Parse object
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("status content isn't a JSON object: %v", err)
+	}
+	*status = StatusContent{present: make(map[string]bool), times: make(map[string]string)}
+
+	// Parse fields
+	var errs []error
+	for name, value := range fields {
+		var err error
+		switch name {
+		case FIELD_DEVICE:
+			err = json.Unmarshal(value, &status.Device)
+		case FIELD_FIRMWARE:
+			err = json.Unmarshal(value, &status.Firmware)
+		case FIELD_DATE:
+			status.Date, err = status.parseTime(name, value)
+		case FIELD_IS_ON:
+			err = json.Unmarshal(value, &status.IsOn)
+		case FIELD_SUNRISE:
+			status.Sunrise, err = status.parseTime(name, value)
+		case FIELD_SUNSET:
+			status.Sunset, err = status.parseTime(name, value)
+		case FIELD_OFFSET:
+			err = json.Unmarshal(value, &status.Offset)
+		case FIELD_NEXT_ACTION:
+			var str string
+			if err = json.Unmarshal(value, &str); err == nil {
+				status.NextAction, err = ParseAction(str)
+			}
+		case FIELD_NEXT_ACTION_TIME:
+			status.NextActionTime, err = status.parseTime(name, value)
+		case FIELD_SUNTIMES:
+			err = json.Unmarshal(value, &status.Suntimes)
+		default:
+			if status.Unknown == nil {
+				status.Unknown = make(map[string]json.RawMessage)
+			}
+			status.Unknown[name] = value
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %s: %v", name, value, err))
+			continue
+		}
+		status.present[name] = true
+	}
+
+	// Report errors in a consistent order
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	sort.Slice(status.warnings, func(i, j int) bool { return status.warnings[i].Error() < status.warnings[j].Error() })
+	return errors.Join(errs...)
+}
+
+// parseTime parses time field `name` from `value`, a JSON string with a time
+// in STATUS_TIME_LAYOUT or STATUS_TIME_LAYOUT_NUMERIC, and keeps the string as
+// reported. Returns an error only if `value` isn't a string. A time that can't
+// be parsed is returned as the zero time, with a warning.
+func (status *StatusContent) parseTime(name string, value json.RawMessage) (time.Time, error) {
+	var str string
+	if err := json.Unmarshal(value, &str); err != nil {
+		return time.Time{}, err
+	}
+	status.times[name] = str
+	t, err := time.Parse(STATUS_TIME_LAYOUT, str)
+	if err != nil {
+		if t, numericErr := time.Parse(STATUS_TIME_LAYOUT_NUMERIC, str); numericErr == nil {
+			return t, nil
+		}
+		status.warnings = append(status.warnings, fmt.Errorf("unable to parse %s '%s': %v", name, str, err))
+	}
+	return t, nil
+}
+
+// value returns the JSON value of status field `field`.
+func (status StatusContent) value(field string) any {
+	switch field {
+	case FIELD_DEVICE:
+		return status.Device
+	case FIELD_FIRMWARE:
+		return status.Firmware
+	case FIELD_DATE, FIELD_SUNRISE, FIELD_SUNSET, FIELD_NEXT_ACTION_TIME:
+		return status.times[field]
+	case FIELD_IS_ON:
+		return status.IsOn
+	case FIELD_OFFSET:
+		return status.Offset
+	case FIELD_NEXT_ACTION:
+		return status.NextAction
+	case FIELD_SUNTIMES:
+		return status.Suntimes
+	default:
+		return status.Unknown[field]
+	}
+}
+
+// FieldString returns the value of status field `field` as a string, and
+// whether the switch reported it. Unknown fields are returned as JSON.
+func (status StatusContent) FieldString(field string) (string, bool) {
+	if raw, ok := status.Unknown[field]; ok {
+		return strings.Trim(string(raw), "\""), true
+	}
+	if !status.Has(field) {
+		return "", false
+	}
+	switch value := status.value(field).(type) {
+	case string:
+		return value, true
+	case bool:
+		return strconv.FormatBool(value), true
+	case int:
+		return strconv.Itoa(value), true
+	case Action:
+		return string(value), true
+	case Suntimes:
+		return value.String(), true
+	default:
+		return fmt.Sprint(value), true
+	}
+}
+
+// Field returns the value of status field `field` as a string, or an empty
+// string if the switch didn't report it. This is for use in templates, as in
+// {{.Field "next_action_time"}}.
+func (status StatusContent) Field(field string) string {
+	str, _ := status.FieldString(field)
+	return str
+}
+
+// Select returns a copy of `status` with only the status fields in `fields`.
+func (status StatusContent) Select(fields []string) StatusContent {
+	selected := status
+	selected.present = make(map[string]bool)
+	selected.Unknown = nil
+	for _, field := range fields {
+		if status.Has(field) {
+			selected.present[field] = true
+		}
+		if raw, ok := status.Unknown[field]; ok {
+			if selected.Unknown == nil {
+				selected.Unknown = make(map[string]json.RawMessage)
+			}
+			selected.Unknown[field] = raw
+		}
+	}
+	return selected
+}
+
+// MarshalJSON returns the JSON encoding of status content, with the fields
+// the switch reported in their usual order followed by any unknown fields.
+func (status StatusContent) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("{")
+	write := func(name string, value any) error {
+		valueBytes, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if buffer.Len() > 1 {
+			buffer.WriteString(",")
+		}
+		nameBytes, _ := json.Marshal(name)
+		buffer.Write(nameBytes)
+		buffer.WriteString(":")
+		buffer.Write(valueBytes)
+		return nil
+	}
+	for _, field := range StatusFields {
+		if status.Has(field) {
+			if err := write(field, status.value(field)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	unknown := make([]string, 0, len(status.Unknown))
+	for field := range status.Unknown {
+		unknown = append(unknown, field)
+	}
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		if err := write(field, status.Unknown[field]); err != nil {
+			return nil, err
+		}
+	}
+	buffer.WriteString("}")
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,145 @@
+package message
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// STATUS_JSON is a status as a switch reports it, with its fields out of order
+// and fields that StatusContent doesn't know.
+const STATUS_JSON = `{
+	"suntimes": {"1": ["6:53 AM", "6:03 PM"], "2": ["6:46 AM", "6:20 PM"]},
+	"next_action_time": "Wed Jan 17 18:44:00 2024 +0330",
+	"zeta": [1, 2],
+	"is_on": true,
+	"device": "esp-vorona",
+	"date": "Wed Jan 17 10:57:55 2024 CST",
+	"sunrise": "Thu Jan 18 06:53:00 2024 CST",
+	"alpha": {"b": 1},
+	"sunset": "Wed Jan 17 18:03:00 2024 CST",
+	"offset": 60,
+	"firmware": "1.2",
+	"next_action": "ON"
+}`
+
+func TestStatusContentUnmarshal(t *testing.T) {
+	var status StatusContent
+	if err := json.Unmarshal([]byte(STATUS_JSON), &status); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(status.Warnings()) != 0 {
+		t.Errorf("unexpected warnings: %v", status.Warnings())
+	}
+	for _, field := range StatusFields {
+		if !status.Has(field) {
+			t.Errorf("field %s is missing", field)
+		}
+	}
+	if status.Device != "esp-vorona" || status.Firmware != "1.2" || !status.IsOn || status.Offset != 60 ||
+		status.NextAction != ACTION_ON {
+		t.Errorf("fields parsed incorrectly: %+v", status)
+	}
+	if got := status.Date.Format("2006-01-02 15:04:05 MST"); got != "2024-01-17 10:57:55 CST" {
+		t.Errorf("date is %s", got)
+	}
+	if _, offset := status.NextActionTime.Zone(); offset != (3*60+30)*60 {
+		t.Errorf("next_action_time has UTC offset %ds, want +0330", offset)
+	}
+	if got := status.Suntimes[2]; got != [2]string{"6:46 AM", "6:20 PM"} {
+		t.Errorf("suntimes for month 2 are %v", got)
+	}
+	if got := string(status.Unknown["alpha"]); got != `{"b": 1}` {
+		t.Errorf("unknown field alpha is %s", got)
+	}
+}
+
+func TestStatusContentMarshal(t *testing.T) {
+	var status StatusContent
+	if err := json.Unmarshal([]byte(STATUS_JSON), &status); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	// Known fields in their usual order, then unknown fields by name, with times
+	// as reported
+	want := `{"device":"esp-vorona","firmware":"1.2","date":"Wed Jan 17 10:57:55 2024 CST","is_on":true,` +
+		`"sunrise":"Thu Jan 18 06:53:00 2024 CST","sunset":"Wed Jan 17 18:03:00 2024 CST","offset":60,` +
+		`"next_action":"ON","next_action_time":"Wed Jan 17 18:44:00 2024 +0330",` +
+		`"suntimes":{"1":["6:53 AM","6:03 PM"],"2":["6:46 AM","6:20 PM"]},"alpha":{"b":1},"zeta":[1,2]}`
+	got, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Selected fields, in their usual order regardless of the order selected
+	selected := status.Select([]string{FIELD_NEXT_ACTION, "zeta", FIELD_IS_ON, "missing"})
+	want = `{"is_on":true,"next_action":"ON","zeta":[1,2]}`
+	if got, err = json.Marshal(selected); err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("got selected:\n%s\nwant:\n%s", got, want)
+	}
+	if selected.Has(FIELD_DEVICE) || selected.Field("alpha") != "" {
+		t.Errorf("fields not selected are still present")
+	}
+}
+
+func TestStatusContentTimeWarnings(t *testing.T) {
+	var status StatusContent
+	data := `{"device": "esp-vorona", "date": "yesterday", "sunset": "Wed Jan 17 18:03:00 2024"}`
+	if err := json.Unmarshal([]byte(data), &status); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	// Unparsable times are warned about, and kept as reported
+	warnings := status.Warnings()
+	if len(warnings) != 2 || !strings.Contains(warnings[0].Error(), "date 'yesterday'") ||
+		!strings.Contains(warnings[1].Error(), "sunset 'Wed Jan 17 18:03:00 2024'") {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+	if !status.Has(FIELD_DATE) || !status.Date.Equal(time.Time{}) {
+		t.Errorf("date is missing or not the zero time: %v", status.Date)
+	}
+	if got := status.Field(FIELD_DATE); got != "yesterday" {
+		t.Errorf("date field is %q, want as reported", got)
+	}
+	want := `{"device":"esp-vorona","date":"yesterday","sunset":"Wed Jan 17 18:03:00 2024"}`
+	if got, err := json.Marshal(status); err != nil || string(got) != want {
+		t.Errorf("got %s (%v), want %s", got, err, want)
+	}
+}
+
+func TestStatusContentErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string // Parts of the errors expected
+	}{
+		{"not an object", `["is_on"]`, []string{"status content isn't a JSON object"}},
+		{"is_on not a bool", `{"is_on": "yes"}`, []string{`invalid is_on "yes"`}},
+		{"unknown action", `{"next_action": "MAYBE"}`, []string{"unrecognized action 'MAYBE'"}},
+		{"action not a string", `{"next_action": 1}`, []string{"invalid next_action 1"}},
+		{"time not a string", `{"date": 20240117}`, []string{"invalid date 20240117"}},
+		{"every malformed field", `{"offset": "60", "is_on": 1, "device": "esp-vorona"}`,
+			[]string{`invalid is_on 1`, `invalid offset "60"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var status StatusContent
+			err := json.Unmarshal([]byte(test.data), &status)
+			if err == nil {
+				t.Fatalf("Unmarshal succeeded, expected an error")
+			}
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("got error %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
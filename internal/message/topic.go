@@ -0,0 +1,70 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TOPIC_PREFIX is the first level of every IndySwitch topic.
+const TOPIC_PREFIX = "indy-switch"
+
+// Topic kinds: the levels of a topic after the device ID.
+const (
+	KIND_CONTROL    = "control"
+	KIND_CONFIG     = "config"
+	KIND_STATUS_GET = "status/get"
+	KIND_RESTART    = "restart"
+	KIND_ACK        = "ack"
+)
+
+// ParseTopic splits an IndySwitch topic such as "indy-switch/esp-vorona/ack"
+// into its device ID and kind.
+func ParseTopic(topic string) (string, string, error) {
+	levels := strings.SplitN(topic, "/", 3)
+	if len(levels) != 3 || levels[0] != TOPIC_PREFIX || levels[1] == "" {
+		return "", "", fmt.Errorf("topic '%s' isn't an IndySwitch topic", topic)
+	}
+	return levels[1], levels[2], nil
+}
+
+// DecodePayload decodes the `payload` of a message published to a topic of
+// `kind`. ACKs are returned as an AckMessage, and commands as a Message with
+// content of the type for the command, such as ControlContent. Payloads of
+// unrecognized kinds are returned as json.RawMessage.
+func DecodePayload(kind string, payload []byte) (any, error) {
+	// Is this an ACK?
+	if kind == KIND_ACK {
+		var ack AckMessage
+		if err := json.Unmarshal(payload, &ack); err != nil {
+			return nil, fmt.Errorf("unable to parse ACK: %v", err)
+		}
+		return ack, nil
+	}
+
+	// What content does this command have?
+	var content any
+	switch kind {
+	case KIND_CONTROL:
+		content = &ControlContent{}
+	case KIND_CONFIG:
+		content = &ConfigContent{}
+	case KIND_STATUS_GET:
+		content = &EmptyContent{}
+	case KIND_RESTART:
+		content = &RestartContent{}
+	default:
+		var raw json.RawMessage
+		if err := json.Unmarshal(payload, &raw); err != nil {
+			return nil, fmt.Errorf("unable to parse %s message: %v", kind, err)
+		}
+		return raw, nil
+	}
+
+	// Parse command
+	msg := Message{Content: content}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, fmt.Errorf("unable to parse %s message: %v", kind, err)
+	}
+	return msg, nil
+}
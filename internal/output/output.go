@@ -0,0 +1,169 @@
+// Package indy-mqtt/internal/output implements Result, for reporting the
+// outcome of a command in human-readable or machine-readable form.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Format is an output format.
+type Format string
+
+// Output formats.
+const (
+	HUMAN Format = "human" // Free-form text, for people
+	JSON  Format = "json"  // One JSON document per host
+	YAML  Format = "yaml"  // One YAML document per host
+)
+
+// ParseFormat returns the Format named by `name`.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case HUMAN, JSON, YAML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unrecognized output format '%s' (expected human, json, or yaml)", name)
+	}
+}
+
+// IsStructured returns whether `format` is machine-readable.
+func (format Format) IsStructured() bool {
+	return format == JSON || format == YAML
+}
+
+// Result holds the outcome of running a command on one host.
+type Result struct {
+	Host       string  `json:"host"`                  // Device ID
+	Topic      string  `json:"topic"`                 // Topic the command was published to
+	MessageID  string  `json:"message_id"`            // ID of the message published
+	Attempts   int     `json:"attempts"`              // How many times the command was published
+	Published  bool    `json:"published"`             // Whether the publish succeeded
+	Acked      bool    `json:"acked"`                 // Whether an ACK was received
+	StatusCode int     `json:"status_code,omitempty"` // Status code from the ACK
+	Message    string  `json:"message,omitempty"`     // Message from the ACK
+	Content    any     `json:"content,omitempty"`     // Content from the ACK, decoded
+	LatencyMS  int64   `json:"latency_ms,omitempty"`  // Milliseconds from publish to ACK
+	Skipped    bool    `json:"skipped,omitempty"`     // Whether nothing was published, since the switch was already in the state requested
+	IsOn       *bool   `json:"is_on,omitempty"`       // Switch state checked after the command, if checked
+	Revert     *Result `json:"revert,omitempty"`      // Outcome of switching back, for commands with a duration
+	Error      string  `json:"error,omitempty"`       // Why the command failed, if it did
+}
+
+// Write writes `result` to `writer` as a single document in the structured
+// `format`.
+func Write(writer io.Writer, format Format, result any) error {
+	switch format {
+	case JSON:
+		bytes, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return fmt.Errorf("unable to format JSON: %v", err)
+		}
+		_, err = fmt.Fprintf(writer, "%s\n", bytes)
+		return err
+	case YAML:
+		bytes, err := MarshalYAML(result)
+		if err != nil {
+			return fmt.Errorf("unable to format YAML: %v", err)
+		}
+		_, err = fmt.Fprintf(writer, "---\n%s", bytes)
+		return err
+	default:
+		return fmt.Errorf("output format '%s' isn't structured", format)
+	}
+}
+
+// Event holds a message seen on an IndySwitch topic, for watch mode.
+type Event struct {
+	Time    time.Time `json:"time"`            // When the message was received
+	Host    string    `json:"host"`            // Device ID from the topic
+	Kind    string    `json:"kind"`            // Topic kind, such as ack
+	Payload any       `json:"payload"`         // Payload, decoded
+	Error   string    `json:"error,omitempty"` // Why the payload couldn't be decoded, if it couldn't
+}
+
+// WriteEvent writes `event` to `writer` in `format`: a single line for human
+// and JSON formats, and a document for YAML.
+func WriteEvent(writer io.Writer, format Format, event Event) error {
+	switch format {
+	case HUMAN:
+		payloadBytes, err := json.Marshal(event.Payload)
+		if err != nil {
+			return fmt.Errorf("unable to format JSON: %v", err)
+		}
+		line := fmt.Sprintf("%s %s %s %s", event.Time.Format(time.TimeOnly), event.Host, event.Kind, payloadBytes)
+		if event.Error != "" {
+			line += fmt.Sprintf(" (%s)", event.Error)
+		}
+		_, err = fmt.Fprintln(writer, line)
+		return err
+	case JSON:
+		bytes, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("unable to format JSON: %v", err)
+		}
+		_, err = fmt.Fprintf(writer, "%s\n", bytes)
+		return err
+	default:
+		return Write(writer, format, event)
+	}
+}
+
+// FieldChange holds the old and new values of a status field that changed.
+type FieldChange struct {
+	Field string `json:"field"`         // Status field name
+	Old   string `json:"old,omitempty"` // Previous value, or empty for the first value seen
+	New   string `json:"new,omitempty"` // Current value, or empty if no longer reported
+}
+
+// StatusChange holds the changes seen in the status of a host while polling.
+type StatusChange struct {
+	Time    time.Time     `json:"time"`              // When the change was seen
+	Host    string        `json:"host"`              // Device ID
+	Initial bool          `json:"initial,omitempty"` // Whether this is the first status seen
+	Changes []FieldChange `json:"changes,omitempty"` // Fields that changed
+	Error   string        `json:"error,omitempty"`   // Why status couldn't be read, if it couldn't
+}
+
+// WriteStatusChange writes `change` to `writer` in `format`. Human format is a
+// diff, with removed values marked - and added values marked +.
+func WriteStatusChange(writer io.Writer, format Format, change StatusChange) error {
+	if format.IsStructured() {
+		return Write(writer, format, change)
+	}
+
+	// Write header
+	header := fmt.Sprintf("%s %s", change.Time.Format(time.TimeOnly), change.Host)
+	if change.Error != "" {
+		_, err := fmt.Fprintf(writer, "%s: %s\n", header, change.Error)
+		return err
+	}
+	if change.Initial {
+		header += " (initial)"
+	}
+	if _, err := fmt.Fprintln(writer, header); err != nil {
+		return err
+	}
+
+	// Write changes
+	for _, fieldChange := range change.Changes {
+		var err error
+		if change.Initial {
+			_, err = fmt.Fprintf(writer, "  %s: %s\n", fieldChange.Field, fieldChange.New)
+		} else {
+			if fieldChange.Old != "" {
+				_, err = fmt.Fprintf(writer, "- %s: %s\n", fieldChange.Field, fieldChange.Old)
+			}
+			if err == nil && fieldChange.New != "" {
+				_, err = fmt.Fprintf(writer, "+ %s: %s\n", fieldChange.Field, fieldChange.New)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
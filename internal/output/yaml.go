@@ -0,0 +1,163 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// yamlField is a key-value pair in a YAML mapping.
+type yamlField struct {
+	key   string
+	value any
+}
+
+// yamlMapping is a YAML mapping, with its fields in their original order.
+type yamlMapping []yamlField
+
+// MarshalYAML returns the YAML encoding of `value`. `value` is first encoded as
+// JSON, so that JSON struct tags are honored and field order is kept.
+func MarshalYAML(value any) ([]byte, error) {
+	// Encode as JSON
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode into ordered nodes
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.UseNumber()
+	node, err := readYAMLNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write YAML
+	var buffer bytes.Buffer
+	writeYAMLNode(&buffer, node, 0)
+	return buffer.Bytes(), nil
+}
+
+// readYAMLNode reads the next JSON value from `decoder`, returning objects as
+// yamlMappings so that their field order is kept.
+func readYAMLNode(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		mapping := yamlMapping{}
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readYAMLNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			mapping = append(mapping, yamlField{key: keyToken.(string), value: value})
+		}
+		_, err = decoder.Token() // Closing brace
+		return mapping, err
+	case json.Delim('['):
+		list := []any{}
+		for decoder.More() {
+			value, err := readYAMLNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = decoder.Token() // Closing bracket
+		return list, err
+	default:
+		return token, nil
+	}
+}
+
+// isCollection returns whether `node` is a non-empty mapping or list, which
+// is written on lines of its own.
+func isCollection(node any) bool {
+	switch node := node.(type) {
+	case yamlMapping:
+		return len(node) > 0
+	case []any:
+		return len(node) > 0
+	default:
+		return false
+	}
+}
+
+// writeYAMLNode writes `node` to `buffer`, with collections indented by
+// `indent` spaces. Scalars are written without a trailing newline.
+func writeYAMLNode(buffer *bytes.Buffer, node any, indent int) {
+	padding := strings.Repeat(" ", indent)
+	switch node := node.(type) {
+	case yamlMapping:
+		if len(node) == 0 {
+			buffer.WriteString("{}")
+			return
+		}
+		for _, field := range node {
+			buffer.WriteString(padding + yamlScalar(field.key) + ":")
+			if isCollection(field.value) {
+				buffer.WriteString("\n")
+				writeYAMLNode(buffer, field.value, indent+2)
+			} else {
+				buffer.WriteString(" ")
+				writeYAMLNode(buffer, field.value, indent)
+				buffer.WriteString("\n")
+			}
+		}
+	case []any:
+		if len(node) == 0 {
+			buffer.WriteString("[]")
+			return
+		}
+		for _, item := range node {
+			buffer.WriteString(padding + "-")
+			if isCollection(item) {
+				buffer.WriteString("\n")
+				writeYAMLNode(buffer, item, indent+2)
+			} else {
+				buffer.WriteString(" ")
+				writeYAMLNode(buffer, item, indent)
+				buffer.WriteString("\n")
+			}
+		}
+	case nil:
+		buffer.WriteString("null")
+	case bool:
+		buffer.WriteString(fmt.Sprint(node))
+	case json.Number:
+		buffer.WriteString(node.String())
+	case string:
+		buffer.WriteString(yamlScalar(node))
+	}
+}
+
+// plainYAMLPattern matches strings that can be written without quotes.
+var plainYAMLPattern = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./ :+-]*$`)
+
+// reservedYAMLWords are plain scalars that YAML parsers may read as
+// something other than a string.
+var reservedYAMLWords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"null": true, "y": true, "n": true,
+}
+
+// yamlScalar returns `str` as a YAML scalar, quoting it if needed.
+func yamlScalar(str string) string {
+	if plainYAMLPattern.MatchString(str) && !reservedYAMLWords[strings.ToLower(str)] &&
+		!strings.Contains(str, ": ") && !strings.HasSuffix(str, ":") && !strings.HasSuffix(str, " ") {
+		return str
+	}
+
+	// JSON strings are valid double-quoted YAML scalars
+	quoted, _ := json.Marshal(str)
+	return string(quoted)
+}
@@ -0,0 +1,91 @@
+package output
+
+import "testing"
+
+func TestYAMLScalar(t *testing.T) {
+	tests := []struct {
+		str  string
+		want string
+	}{
+		{"esp-vorona", "esp-vorona"},
+		{"Wed Jan 17 10:57:55 2024 CST", "Wed Jan 17 10:57:55 2024 CST"},
+		{"indy-switch/esp-vorona/ack", "indy-switch/esp-vorona/ack"},
+		{"", `""`},
+		{"ON", `"ON"`},
+		{"off", `"off"`},
+		{"Yes", `"Yes"`},
+		{"null", `"null"`},
+		{"n", `"n"`},
+		{"1", `"1"`},
+		{"1.2", `"1.2"`},
+		{"-1", `"-1"`},
+		{"6:53 AM", `"6:53 AM"`},
+		{"key: value", `"key: value"`},
+		{"ends with colon:", `"ends with colon:"`},
+		{"trailing space ", `"trailing space "`},
+		{"line 1\nline 2", `"line 1\nline 2"`},
+		{"# comment", `"# comment"`},
+		{"it's", `"it's"`},
+		{`say "hi"`, `"say \"hi\""`},
+	}
+	for _, test := range tests {
+		if got := yamlScalar(test.str); got != test.want {
+			t.Errorf("yamlScalar(%q) = %s, want %s", test.str, got, test.want)
+		}
+	}
+}
+
+func TestMarshalYAML(t *testing.T) {
+	type status struct {
+		Device   string              `json:"device"`
+		IsOn     bool                `json:"is_on"`
+		Offset   int                 `json:"offset"`
+		Action   string              `json:"next_action"`
+		Message  string              `json:"message"`
+		Suntimes map[string][]string `json:"suntimes"`
+		Empty    map[string]any      `json:"empty"`
+		None     []string            `json:"none"`
+		Nested   []any               `json:"nested"`
+		Missing  *string             `json:"missing"`
+	}
+	value := status{
+		Device:   "esp-vorona",
+		IsOn:     true,
+		Offset:   60,
+		Action:   "ON",
+		Message:  "two\nlines",
+		Suntimes: map[string][]string{"1": {"6:53 AM", "6:03 PM"}, "12": {"6:42 AM", "5:46 PM"}},
+		Empty:    map[string]any{},
+		None:     []string{},
+		Nested:   []any{map[string]any{}, []any{}, map[string]any{"a": []any{}}, "x"},
+	}
+	want := `device: esp-vorona
+is_on: true
+offset: 60
+next_action: "ON"
+message: "two\nlines"
+suntimes:
+  "1":
+    - "6:53 AM"
+    - "6:03 PM"
+  "12":
+    - "6:42 AM"
+    - "5:46 PM"
+empty: {}
+none: []
+nested:
+  - {}
+  - []
+  -
+    a: []
+  - x
+missing: null
+`
+	got, err := MarshalYAML(value)
+	if err != nil {
+		t.Fatalf("MarshalYAML failed: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,360 @@
+package suntimes
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/util"
+)
+
+// Methods for reducing daily tables to one sunrise and sunset time per month.
+const (
+	REDUCE_MEDIAN    = "median"    // Median of the times for each month
+	REDUCE_MID_MONTH = "mid-month" // Times for the day closest to REPRESENTATIVE_DAY
+)
+
+// timeLayouts are the layouts accepted for sunrise and sunset times, after
+// converting to upper case.
+var timeLayouts = []string{"3:04 PM", "3:04PM", "3:04:05 PM", "3:04:05PM", "15:04", "15:04:05"}
+
+// dateLayouts are the layouts accepted for dates in daily tables.
+var dateLayouts = []string{"2006-01-02", "1/2/2006", "1/2"}
+
+// row is a row of a sunrise and sunset table, with times in minutes since
+// midnight.
+type row struct {
+	month   int
+	day     int // Day of the month, or 0 for monthly tables
+	sunrise int
+	sunset  int
+}
+
+// ReadFile reads, parses, and validates the suntimes file `filename`, and
+// returns its times in the format the switch uses. The file can be JSON in the
+// same format as that used by indy-switch. For example:
+//
+//	{
+//	  "1":  ["6:53 AM", "6:03 PM"],
+//	  "2":  ["6:46 AM", "6:20 PM"],
+//	  "3":  ["6:26 AM", "6:29 PM"],
+//	  "4":  ["6:02 AM", "6:36 PM"],
+//	  "5":  ["5:45 AM", "6:45 PM"],
+//	  "6":  ["5:43 AM", "6:56 PM"],
+//	  "7":  ["5:51 AM", "6:58 PM"],
+//	  "8":  ["6:01 AM", "6:45 PM"],
+//	  "9":  ["6:07 AM", "6:20 PM"],
+//	  "10": ["6:12 AM", "5:57 PM"],
+//	  "11": ["6:25 AM", "5:42 PM"],
+//	  "12": ["6:42 AM", "5:46 PM"]
+//	}
+//
+// Or the file can be a table, with values separated by commas, tabs, or
+// spaces, and an optional header line. Each row of a monthly table has the
+// month, sunrise, and sunset, and each row of a daily table has either the
+// date, sunrise, and sunset, or the month, day, sunrise, and sunset. Daily
+// tables are reduced to one time per month with `reduce`. Times can be in
+// 12-hour or 24-hour format.
+func ReadFile(filename string, reduce string) (message.Suntimes, error) {
+	if reduce != REDUCE_MEDIAN && reduce != REDUCE_MID_MONTH {
+		return nil, fmt.Errorf("suntimes --reduce needs to be %s or %s instead of %s", REDUCE_MEDIAN, REDUCE_MID_MONTH, reduce)
+	}
+
+	// Read file
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, util.InputError{Err: fmt.Errorf("unable to open '%s': %v", filename, err)}
+	}
+
+	// Parse file
+	var suntimes message.Suntimes
+	if isJSON(filename, data) {
+		suntimes, err = parseJSON(data)
+	} else {
+		suntimes, err = parseTable(string(data), reduce)
+	}
+	if err != nil {
+		return nil, util.InputError{Err: fmt.Errorf("unable to parse '%s': %v", filename, err)}
+	}
+
+	// Validate suntimes
+	if err := Validate(suntimes); err != nil {
+		return nil, util.InputError{Err: fmt.Errorf("invalid suntimes in '%s':\n%v", filename, err)}
+	}
+
+	return suntimes, nil
+}
+
+// isJSON returns whether the file `filename` with contents `data` is JSON,
+// going by its extension, or its contents if the extension isn't known.
+func isJSON(filename string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return true
+	case ".csv", ".tsv", ".txt":
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(string(data)), "{")
+}
+
+// parseJSON parses suntimes in JSON, converting times to the format the switch
+// uses. Times that can't be parsed are left as is, for Validate to report.
+func parseJSON(data []byte) (message.Suntimes, error) {
+	var suntimes message.Suntimes
+	if err := json.Unmarshal(data, &suntimes); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	for month, times := range suntimes {
+		for i, str := range times {
+			if minutes, err := parseTime(str); err == nil {
+				times[i] = formatMinutes(minutes)
+			}
+		}
+		suntimes[month] = times
+	}
+	return suntimes, nil
+}
+
+// parseTable parses a monthly or daily table of sunrise and sunset times in
+// `data`, reducing daily tables to monthly times with `reduce`.
+func parseTable(data string, reduce string) (message.Suntimes, error) {
+	// Parse rows
+	var rows []row
+	var errs []error
+	isFirst := true
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields, err := splitFields(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %v", i+1, err))
+			isFirst = false
+			continue
+		}
+		parsed, err := parseRow(fields)
+		isHeaderLine := isFirst && err != nil && isHeader(fields)
+		isFirst = false
+		if isHeaderLine {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %v", i+1, err))
+			continue
+		}
+		rows = append(rows, parsed)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no sunrise and sunset times found")
+	}
+
+	// Is this a daily or monthly table?
+	isDaily := rows[0].day != 0
+	for _, row := range rows {
+		if (row.day != 0) != isDaily {
+			return nil, fmt.Errorf("table mixes monthly and daily rows")
+		}
+	}
+	if isDaily {
+		return reduceDaily(rows, reduce), nil
+	}
+
+	// Convert monthly table
+	suntimes := make(message.Suntimes)
+	for _, row := range rows {
+		if _, ok := suntimes[row.month]; ok {
+			return nil, fmt.Errorf("month %d is given more than once", row.month)
+		}
+		suntimes[row.month] = [2]string{formatMinutes(row.sunrise), formatMinutes(row.sunset)}
+	}
+	return suntimes, nil
+}
+
+// isHeader returns whether `fields` are a header, where none of them is a
+// month, date, or time.
+func isHeader(fields []string) bool {
+	for _, field := range fields {
+		if _, err := parseMonth(field); err == nil {
+			return false
+		}
+		if _, _, err := parseDate(field); err == nil {
+			return false
+		}
+		if _, err := parseTime(field); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// splitFields splits `line` into fields separated by tabs, commas, or spaces,
+// in that order of preference. When splitting on spaces, AM and PM are kept
+// with the time before them.
+func splitFields(line string) ([]string, error) {
+	// Tabs or commas?
+	if strings.Contains(line, "\t") || strings.Contains(line, ",") {
+		reader := csv.NewReader(strings.NewReader(line))
+		if strings.Contains(line, "\t") {
+			reader.Comma = '\t'
+		}
+		reader.TrimLeadingSpace = true
+		return reader.Read()
+	}
+
+	// Spaces
+	var fields []string
+	for _, field := range strings.Fields(line) {
+		upper := strings.ToUpper(field)
+		if (upper == "AM" || upper == "PM") && len(fields) > 0 {
+			fields[len(fields)-1] += " " + field
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// parseRow parses the `fields` of a table row, which are either the month or
+// date, sunrise, and sunset, or the month, day, sunrise, and sunset.
+func parseRow(fields []string) (row, error) {
+	var parsed row
+	var err error
+	switch len(fields) {
+	case 3:
+		if parsed.month, err = parseMonth(fields[0]); err != nil {
+			if parsed.month, parsed.day, err = parseDate(fields[0]); err != nil {
+				return row{}, fmt.Errorf("expected a month or date instead of '%s'", fields[0])
+			}
+		}
+	case 4:
+		if parsed.month, err = parseMonth(fields[0]); err != nil {
+			return row{}, err
+		}
+		parsed.day, err = strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil || parsed.day < 1 || parsed.day > 31 {
+			return row{}, fmt.Errorf("expected a day from 1 to 31 instead of '%s'", fields[1])
+		}
+	default:
+		return row{}, fmt.Errorf("expected month, sunrise, and sunset, or a date or month and day, sunrise, and sunset")
+	}
+	times := fields[len(fields)-2:]
+	if parsed.sunrise, err = parseTime(times[0]); err != nil {
+		return row{}, err
+	}
+	if parsed.sunset, err = parseTime(times[1]); err != nil {
+		return row{}, err
+	}
+	return parsed, nil
+}
+
+// parseMonth parses `str` as a month number from 1 to 12, or a month name such
+// as Jan or January.
+func parseMonth(str string) (int, error) {
+	str = strings.TrimSpace(str)
+	if month, err := strconv.Atoi(str); err == nil && month >= 1 && month <= 12 {
+		return month, nil
+	}
+	for _, layout := range []string{"Jan", "January"} {
+		if t, err := time.Parse(layout, str); err == nil {
+			return int(t.Month()), nil
+		}
+	}
+	return 0, fmt.Errorf("expected a month instead of '%s'", str)
+}
+
+// parseDate parses `str` as a date in any of dateLayouts, and returns the
+// month and day.
+func parseDate(str string) (int, int, error) {
+	str = strings.TrimSpace(str)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			return int(t.Month()), t.Day(), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("expected a date instead of '%s'", str)
+}
+
+// parseTime parses sunrise or sunset time `str` in any of timeLayouts, and
+// returns the minutes since midnight, rounded to the minute.
+func parseTime(str string) (int, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(str))
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, normalized); err == nil {
+			t = t.Round(time.Minute)
+			return t.Hour()*60 + t.Minute(), nil
+		}
+	}
+	return 0, fmt.Errorf("expected a time such as 6:53 AM or 18:03 instead of '%s'", str)
+}
+
+// formatMinutes returns `minutes` since midnight in the layout the switch
+// uses.
+func formatMinutes(minutes int) string {
+	return time.Date(2000, time.January, 1, 0, minutes, 0, 0, time.UTC).Format(TIME_LAYOUT)
+}
+
+// reduceDaily reduces the daily table `rows` to one sunrise and sunset time
+// for each month, by `reduce`.
+func reduceDaily(rows []row, reduce string) message.Suntimes {
+	// Group by month
+	byMonth := make(map[int][]row)
+	for _, row := range rows {
+		byMonth[row.month] = append(byMonth[row.month], row)
+	}
+
+	// Reduce each month
+	suntimes := make(message.Suntimes)
+	for month, monthRows := range byMonth {
+		var sunrise, sunset int
+		switch reduce {
+		case REDUCE_MID_MONTH:
+			closest := monthRows[0]
+			for _, row := range monthRows[1:] {
+				if abs(row.day-REPRESENTATIVE_DAY) < abs(closest.day-REPRESENTATIVE_DAY) {
+					closest = row
+				}
+			}
+			sunrise, sunset = closest.sunrise, closest.sunset
+		default:
+			sunrises := make([]int, len(monthRows))
+			sunsets := make([]int, len(monthRows))
+			for i, row := range monthRows {
+				sunrises[i] = row.sunrise
+				sunsets[i] = row.sunset
+			}
+			sunrise, sunset = median(sunrises), median(sunsets)
+		}
+		suntimes[month] = [2]string{formatMinutes(sunrise), formatMinutes(sunset)}
+	}
+	return suntimes
+}
+
+// median returns the median of `values`, rounded to the nearest integer.
+func median(values []int) int {
+	sort.Ints(values)
+	middle := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[middle]
+	}
+	return (values[middle-1] + values[middle] + 1) / 2
+}
+
+// abs returns the absolute value of `value`.
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
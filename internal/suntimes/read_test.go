@@ -0,0 +1,149 @@
+package suntimes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/util"
+)
+
+func TestParseTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		reduce string
+		want   message.Suntimes
+	}{
+		{"monthly CSV", "1,6:53 AM,6:03 PM\n2,6:46 AM,6:20 PM\n", REDUCE_MEDIAN,
+			message.Suntimes{1: {"6:53 AM", "6:03 PM"}, 2: {"6:46 AM", "6:20 PM"}}},
+		{"header", "Month,Sunrise,Sunset\n1,6:53 AM,6:03 PM\n", REDUCE_MEDIAN,
+			message.Suntimes{1: {"6:53 AM", "6:03 PM"}}},
+		{"comments and blank lines", "# Austin\n\n1, 6:53 AM, 6:03 PM\n\n", REDUCE_MEDIAN,
+			message.Suntimes{1: {"6:53 AM", "6:03 PM"}}},
+		{"24-hour times in TSV", "month\tsunrise\tsunset\n1\t06:53\t18:03\n12\t6:42\t17:46\n", REDUCE_MEDIAN,
+			message.Suntimes{1: {"6:53 AM", "6:03 PM"}, 12: {"6:42 AM", "5:46 PM"}}},
+		{"seconds rounded", "1,6:53:31 AM,18:02:29\n", REDUCE_MEDIAN,
+			message.Suntimes{1: {"6:54 AM", "6:02 PM"}}},
+		{"month names with spaces", "Jan 6:53 AM 6:03 PM\nFebruary 6:46 am 6:20 pm\nMar 6:26AM 6:29PM\n", REDUCE_MEDIAN,
+			message.Suntimes{1: {"6:53 AM", "6:03 PM"}, 2: {"6:46 AM", "6:20 PM"}, 3: {"6:26 AM", "6:29 PM"}}},
+		{"daily ISO dates, median", "Date,Sunrise,Sunset\n2024-01-01,7:00 AM,5:00 PM\n" +
+			"2024-01-15,7:10 AM,5:20 PM\n2024-01-31,7:30 AM,5:40 PM\n2024-02-01,7:00 AM,6:00 PM\n" +
+			"2024-02-02,7:11 AM,6:01 PM\n", REDUCE_MEDIAN,
+			message.Suntimes{1: {"7:10 AM", "5:20 PM"}, 2: {"7:06 AM", "6:01 PM"}}},
+		{"daily m/d dates, mid-month", "1/1 7:00 AM 5:00 PM\n1/16 7:10 AM 5:20 PM\n1/31 7:30 AM 5:40 PM\n", REDUCE_MID_MONTH,
+			message.Suntimes{1: {"7:10 AM", "5:20 PM"}}},
+		{"daily m/d/yyyy dates", "1/15/2024,7:10 AM,5:20 PM\n", REDUCE_MEDIAN,
+			message.Suntimes{1: {"7:10 AM", "5:20 PM"}}},
+		{"daily month and day", "Month\tDay\tSunrise\tSunset\nJan\t14\t07:09\t17:19\nJan\t15\t07:10\t17:20\n", REDUCE_MID_MONTH,
+			message.Suntimes{1: {"7:10 AM", "5:20 PM"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseTable(test.data, test.reduce)
+			if err != nil {
+				t.Fatalf("parseTable failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTableErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string // Part of the error expected
+	}{
+		{"empty", "", "no sunrise and sunset times found"},
+		{"header only", "Month,Sunrise,Sunset\n", "no sunrise and sunset times found"},
+		{"first line with a time isn't a header", "Jan,7:00 AM,later\n2,6:46 AM,6:20 PM\n",
+			"line 1: expected a time such as 6:53 AM or 18:03 instead of 'later'"},
+		{"header after the first line", "1,6:53 AM,6:03 PM\nMonth,Sunrise,Sunset\n",
+			"line 2: expected a month or date instead of 'Month'"},
+		{"every bad line reported", "Month,Sunrise,Sunset\n13,6:53 AM,6:03 PM\n2,6:46 AM\n",
+			"line 2: expected a month or date instead of '13'\nline 3: expected month, sunrise, and sunset"},
+		{"day out of range", "1,32,7:00 AM,5:00 PM\n", "line 1: expected a day from 1 to 31 instead of '32'"},
+		{"mixed daily and monthly", "1,6:53 AM,6:03 PM\n2024-02-15,6:46 AM,6:20 PM\n", "table mixes monthly and daily rows"},
+		{"month given twice", "1,6:53 AM,6:03 PM\nJan,6:53 AM,6:03 PM\n", "month 1 is given more than once"},
+		{"unbalanced quotes", "\"1,6:53 AM,6:03 PM\n", "line 1:"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseTable(test.data, REDUCE_MEDIAN)
+			if err == nil {
+				t.Fatalf("parseTable returned %v, expected an error", got)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %q, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	suntimes := validSuntimes()
+	json := Format(suntimes)
+	var csv strings.Builder
+	for _, month := range suntimes.Months() {
+		fmt.Fprintf(&csv, "%d,%s,%s\n", month, suntimes[month][0], suntimes[month][1])
+	}
+
+	// JSON and CSV files, by extension and by contents
+	for _, path := range []string{write("times.json", json), write("times", json),
+		write("times.csv", csv.String()), write("times.txt", csv.String())} {
+		got, err := ReadFile(path, REDUCE_MEDIAN)
+		if err != nil {
+			t.Errorf("ReadFile(%s) failed: %v", filepath.Base(path), err)
+		} else if !reflect.DeepEqual(got, validSuntimes()) {
+			t.Errorf("ReadFile(%s) = %v, want %v", filepath.Base(path), got, validSuntimes())
+		}
+	}
+
+	// JSON times converted to the switch's format
+	got, err := parseJSON([]byte(`{"1": ["06:53", "18:03"], "2": ["6:46 am", "bad"]}`))
+	if err != nil {
+		t.Fatalf("parseJSON failed: %v", err)
+	}
+	if want := (message.Suntimes{1: {"6:53 AM", "6:03 PM"}, 2: {"6:46 AM", "bad"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseJSON = %v, want %v", got, want)
+	}
+
+	// Errors
+	tests := []struct {
+		name    string
+		path    string
+		reduce  string
+		isInput bool // Whether the error is a util.InputError
+	}{
+		{"unknown reduce method", write("reduce.csv", csv.String()), "mean", false},
+		{"missing file", filepath.Join(dir, "missing.csv"), REDUCE_MEDIAN, true},
+		{"invalid JSON", write("invalid.json", "{\"1\": "), REDUCE_MEDIAN, true},
+		{"invalid table", write("invalid.csv", "1,6:53 AM\n"), REDUCE_MEDIAN, true},
+		{"invalid suntimes", write("partial.csv", "1,6:53 AM,6:03 PM\n"), REDUCE_MEDIAN, true},
+	}
+	for _, test := range tests {
+		_, err := ReadFile(test.path, test.reduce)
+		var inputErr util.InputError
+		if err == nil {
+			t.Errorf("%s: ReadFile succeeded, expected an error", test.name)
+		} else if errors.As(err, &inputErr) != test.isInput {
+			t.Errorf("%s: got error %q, expected it to be an InputError: %v", test.name, err, test.isInput)
+		}
+	}
+}
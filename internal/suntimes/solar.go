@@ -0,0 +1,93 @@
+package suntimes
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Zenith angles of the sun, in degrees, at sunrise and sunset and at the start
+// of morning and end of evening twilight.
+const (
+	ZENITH_OFFICIAL     = 90.833
+	ZENITH_CIVIL        = 96
+	ZENITH_NAUTICAL     = 102
+	ZENITH_ASTRONOMICAL = 108
+)
+
+// Twilights maps the names of the twilight variants to their zenith angles,
+// where the empty name is sunrise and sunset.
+var Twilights = map[string]float64{
+	"":             ZENITH_OFFICIAL,
+	"civil":        ZENITH_CIVIL,
+	"nautical":     ZENITH_NAUTICAL,
+	"astronomical": ZENITH_ASTRONOMICAL,
+}
+
+// sinDeg returns the sine of `degrees`.
+func sinDeg(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+// cosDeg returns the cosine of `degrees`.
+func cosDeg(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180)
+}
+
+// normalize returns `value` within [0, `limit`).
+func normalize(value float64, limit float64) float64 {
+	value = math.Mod(value, limit)
+	if value < 0 {
+		value += limit
+	}
+	return value
+}
+
+// sunTime returns the time the sun crosses `zenith` on `date`, at latitude
+// `lat` and longitude `lon`, rising if `rising` is true and otherwise setting.
+// Only the year, month, and day of `date` are used. This is the algorithm from
+// the Almanac for Computers, 1990, which is accurate to within a couple of
+// minutes outside the polar regions.
+func sunTime(date time.Time, lat float64, lon float64, zenith float64, rising bool) (time.Time, error) {
+	// Approximate time, in days since the start of the year
+	lonHour := lon / 15
+	t := float64(date.YearDay())
+	if rising {
+		t += (6 - lonHour) / 24
+	} else {
+		t += (18 - lonHour) / 24
+	}
+
+	// Sun's mean anomaly, and true longitude
+	meanAnomaly := 0.9856*t - 3.289
+	trueLon := normalize(meanAnomaly+1.916*sinDeg(meanAnomaly)+0.020*sinDeg(2*meanAnomaly)+282.634, 360)
+
+	// Sun's right ascension, in the same quadrant as its true longitude, in hours
+	rightAscension := normalize(math.Atan(0.91764*math.Tan(trueLon*math.Pi/180))*180/math.Pi, 360)
+	rightAscension += math.Floor(trueLon/90)*90 - math.Floor(rightAscension/90)*90
+	rightAscension /= 15
+
+	// Sun's declination
+	sinDec := 0.39782 * sinDeg(trueLon)
+	cosDec := math.Cos(math.Asin(sinDec))
+
+	// Sun's local hour angle
+	cosHour := (cosDeg(zenith) - sinDec*sinDeg(lat)) / (cosDec * cosDeg(lat))
+	if cosHour > 1 {
+		return time.Time{}, fmt.Errorf("the sun stays below %g° from zenith all day on %s", zenith, date.Format(time.DateOnly))
+	}
+	if cosHour < -1 {
+		return time.Time{}, fmt.Errorf("the sun stays above %g° from zenith all day on %s", zenith, date.Format(time.DateOnly))
+	}
+	hour := math.Acos(cosHour) * 180 / math.Pi
+	if rising {
+		hour = 360 - hour
+	}
+	hour /= 15
+
+	// Local mean time, and UTC
+	meanTime := hour + rightAscension - 0.06571*t - 6.622
+	utcHours := normalize(meanTime-lonHour, 24)
+	midnight := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	return midnight.Add(time.Duration(utcHours * float64(time.Hour))), nil
+}
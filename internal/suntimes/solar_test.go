@@ -0,0 +1,88 @@
+package suntimes
+
+import (
+	"testing"
+	"time"
+)
+
+// MAX_ERROR is how far computed times can be from published tables.
+const MAX_ERROR = 2 * time.Minute
+
+func TestGenerate(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	austin := &Site{Latitude: 30.27, Longitude: -97.74, Location: chicago}
+	austinCivil := &Site{Latitude: 30.27, Longitude: -97.74, Location: chicago, Twilight: "civil"}
+	helsinkiSite := &Site{Latitude: 60.17, Longitude: 24.94, Location: helsinki}
+
+	// Times for the 15th of the month in 2024, from NOAA's solar calculator
+	tests := []struct {
+		name    string
+		site    *Site
+		month   int
+		sunrise string
+		sunset  string
+	}{
+		{"Austin January", austin, 1, "7:28 AM", "5:52 PM"},
+		{"Austin March, daylight saving time", austin, 3, "7:40 AM", "7:39 PM"},
+		{"Austin June", austin, 6, "6:29 AM", "8:34 PM"},
+		{"Austin September", austin, 9, "7:16 AM", "7:36 PM"},
+		{"Austin December", austin, 12, "7:20 AM", "5:33 PM"},
+		{"Austin June, civil twilight", austinCivil, 6, "6:01 AM", "9:02 PM"},
+		{"Helsinki June", helsinkiSite, 6, "3:54 AM", "10:47 PM"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			suntimes, err := Generate(test.site, 2024)
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			times := suntimes[test.month]
+			for i, want := range []string{test.sunrise, test.sunset} {
+				if diff := minutesApart(t, times[i], want); diff > MAX_ERROR {
+					t.Errorf("got %s, want %s within %v", times[i], want, MAX_ERROR)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateValid(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	suntimes, err := Generate(&Site{Latitude: 30.27, Longitude: -97.74, Location: chicago}, 2024)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if err := Validate(suntimes); err != nil {
+		t.Errorf("generated suntimes aren't valid: %v", err)
+	}
+}
+
+func TestGeneratePolar(t *testing.T) {
+	if _, err := Generate(&Site{Latitude: 78, Longitude: 15, Location: time.UTC}, 2024); err == nil {
+		t.Error("expected an error for a month without sunrise")
+	}
+}
+
+// minutesApart returns how far apart times `a` and `b` are, in TIME_LAYOUT.
+func minutesApart(t *testing.T, a string, b string) time.Duration {
+	t.Helper()
+	timeA, err := time.Parse(TIME_LAYOUT, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeB, err := time.Parse(TIME_LAYOUT, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return timeA.Sub(timeB).Abs()
+}
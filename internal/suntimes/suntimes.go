@@ -0,0 +1,159 @@
+// Package indy-mqtt/internal/suntimes implements creating the sunrise and
+// sunset times the switch is configured with, for each month.
+package suntimes
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"indy-mqtt/internal/message"
+	"indy-mqtt/internal/util"
+)
+
+// TIME_LAYOUT is the layout of sunrise and sunset times for the switch, such
+// as "6:53 AM".
+const TIME_LAYOUT = "3:04 PM"
+
+// REPRESENTATIVE_DAY is the day of each month that sunrise and sunset are
+// computed for.
+const REPRESENTATIVE_DAY = 15
+
+// Site is where sunrise and sunset times are computed for.
+type Site struct {
+	Latitude  float64        // Degrees north
+	Longitude float64        // Degrees east
+	Location  *time.Location // Timezone times are given in
+	Twilight  string         // Twilight variant, from Twilights, or empty for sunrise and sunset
+}
+
+// ParseSite parses the options in `args` for the site to compute sunrise and
+// sunset times for: --lat and --lon in degrees, --tz with an IANA timezone
+// name, and optionally --twilight with civil, nautical, or astronomical.
+func ParseSite(args []string) (*Site, error) {
+	// Parse options
+	var site Site
+	flags := flag.NewFlagSet("suntimes", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Float64Var(&site.Latitude, "lat", math.NaN(), "")
+	flags.Float64Var(&site.Longitude, "lon", math.NaN(), "")
+	tzStr := flags.String("tz", "", "")
+	flags.StringVar(&site.Twilight, "twilight", "", "")
+	if err := flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("suntimes: %v", err)
+	}
+	if flags.NArg() != 0 {
+		return nil, fmt.Errorf("unexpected arguments for suntimes: %s", strings.Join(flags.Args(), " "))
+	}
+
+	// Check options
+	if math.IsNaN(site.Latitude) || math.IsNaN(site.Longitude) || *tzStr == "" {
+		return nil, fmt.Errorf("suntimes needs --lat, --lon, and --tz")
+	}
+	if site.Latitude < -90 || site.Latitude > 90 {
+		return nil, fmt.Errorf("latitude needs to be from -90 to 90")
+	}
+	if site.Longitude < -180 || site.Longitude > 180 {
+		return nil, fmt.Errorf("longitude needs to be from -180 to 180")
+	}
+	if _, ok := Twilights[site.Twilight]; !ok {
+		return nil, fmt.Errorf("twilight needs to be civil, nautical, or astronomical instead of %s", site.Twilight)
+	}
+	location, err := time.LoadLocation(*tzStr)
+	if err != nil {
+		return nil, util.InputError{Err: fmt.Errorf("unknown timezone '%s': %v", *tzStr, err)}
+	}
+	site.Location = location
+
+	return &site, nil
+}
+
+// Load returns the suntimes given by `args`: either the options for a site, as
+// parsed by ParseSite, to generate them for this year, or the name of a file
+// to read them from with ReadFile, optionally followed by --reduce with the
+// method for reducing daily tables. Errors in the suntimes, rather than in
+// `args`, are returned as util.InputError.
+func Load(args []string) (message.Suntimes, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("suntimes file name or site missing")
+	}
+
+	// Generate from site?
+	if strings.HasPrefix(args[0], "-") {
+		site, err := ParseSite(args)
+		if err != nil {
+			return nil, err
+		}
+		generated, err := Generate(site, time.Now().Year())
+		if err != nil {
+			return nil, util.InputError{Err: err}
+		}
+		if err := Validate(generated); err != nil {
+			return nil, util.InputError{Err: fmt.Errorf("invalid suntimes generated for the site:\n%v", err)}
+		}
+		return generated, nil
+	}
+
+	// Read file
+	filename := args[0]
+	flags := flag.NewFlagSet("suntimes", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	reduce := flags.String("reduce", REDUCE_MEDIAN, "")
+	if err := flags.Parse(args[1:]); err != nil {
+		return nil, fmt.Errorf("suntimes: %v", err)
+	}
+	if flags.NArg() != 0 {
+		return nil, fmt.Errorf("unexpected arguments for suntimes: %s", strings.Join(flags.Args(), " "))
+	}
+	return ReadFile(filename, *reduce)
+}
+
+// Generate returns the sunrise and sunset times at `site` for each month of
+// `year`, computed for the middle of each month in the local time of the site.
+// When a twilight variant is given, the start of morning twilight and end of
+// evening twilight are returned instead.
+func Generate(site *Site, year int) (message.Suntimes, error) {
+	zenith := Twilights[site.Twilight]
+	suntimes := make(message.Suntimes)
+	for month := time.January; month <= time.December; month++ {
+		date := time.Date(year, month, REPRESENTATIVE_DAY, 12, 0, 0, 0, site.Location)
+		sunrise, err := sunTime(date, site.Latitude, site.Longitude, zenith, true)
+		if err != nil {
+			return nil, err
+		}
+		sunset, err := sunTime(date, site.Latitude, site.Longitude, zenith, false)
+		if err != nil {
+			return nil, err
+		}
+		suntimes[int(month)] = [2]string{formatTime(sunrise, site.Location), formatTime(sunset, site.Location)}
+	}
+	return suntimes, nil
+}
+
+// formatTime returns `t` in `location`, rounded to the minute, in the layout
+// the switch uses.
+func formatTime(t time.Time, location *time.Location) string {
+	return t.In(location).Round(time.Minute).Format(TIME_LAYOUT)
+}
+
+// Format returns `suntimes` as JSON, with a line for each month in order, as
+// read by the config suntimes command.
+func Format(suntimes message.Suntimes) string {
+	var builder strings.Builder
+	builder.WriteString("{\n")
+	months := suntimes.Months()
+	for i, month := range months {
+		times := suntimes[month]
+		key := fmt.Sprintf("\"%d\":", month)
+		builder.WriteString(fmt.Sprintf("  %-5s [\"%s\", \"%s\"]", key, times[0], times[1]))
+		if i < len(months)-1 {
+			builder.WriteString(",")
+		}
+		builder.WriteString("\n")
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
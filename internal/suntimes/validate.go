@@ -0,0 +1,107 @@
+package suntimes
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"indy-mqtt/internal/message"
+)
+
+// MAX_MONTHLY_CHANGE is the most that sunrise or sunset can plausibly change
+// from one month to the next. This allows for daylight saving time, and the
+// fast changes at high latitudes around the equinoxes, while catching mistakes
+// such as AM for PM.
+const MAX_MONTHLY_CHANGE = 4 * time.Hour
+
+// Validate checks that `suntimes` has sunrise and sunset times for all 12
+// months and no others, that each time is in the h:mm AM/PM format the switch
+// uses, that sunrise precedes sunset, and that times change plausibly from one
+// month to the next. Returns an error that lists every problem found, by
+// month.
+func Validate(suntimes message.Suntimes) error {
+	type problem struct {
+		month int
+		err   error
+	}
+	var problems []problem
+	report := func(month int, format string, v ...any) {
+		problems = append(problems, problem{month: month, err: fmt.Errorf("month %d: %s", month, fmt.Sprintf(format, v...))})
+	}
+
+	// Are all the months there, and only those?
+	for month := 1; month <= 12; month++ {
+		if _, ok := suntimes[month]; !ok {
+			report(month, "missing")
+		}
+	}
+	for _, month := range suntimes.Months() {
+		if month < 1 || month > 12 {
+			report(month, "not a month from 1 to 12")
+		}
+	}
+
+	// Parse times, and check sunrise precedes sunset
+	type parsedTimes struct {
+		sunrise, sunset time.Time
+	}
+	parsed := make(map[int]parsedTimes)
+	for month := 1; month <= 12; month++ {
+		times, ok := suntimes[month]
+		if !ok {
+			continue
+		}
+		sunrise, sunriseErr := parseSwitchTime(times[0])
+		if sunriseErr != nil {
+			report(month, "sunrise '%s' isn't in the h:mm AM/PM format", times[0])
+		}
+		sunset, sunsetErr := parseSwitchTime(times[1])
+		if sunsetErr != nil {
+			report(month, "sunset '%s' isn't in the h:mm AM/PM format", times[1])
+		}
+		if sunriseErr != nil || sunsetErr != nil {
+			continue
+		}
+		if !sunrise.Before(sunset) {
+			report(month, "sunrise %s isn't before sunset %s", times[0], times[1])
+			continue
+		}
+		parsed[month] = parsedTimes{sunrise: sunrise, sunset: sunset}
+	}
+
+	// Are changes from the previous month plausible?
+	for month := 1; month <= 12; month++ {
+		previousMonth := (month+10)%12 + 1
+		current, ok := parsed[month]
+		previous, previousOk := parsed[previousMonth]
+		if !ok || !previousOk {
+			continue
+		}
+		if change := current.sunrise.Sub(previous.sunrise).Abs(); change > MAX_MONTHLY_CHANGE {
+			report(month, "sunrise changes by %v from month %d", change, previousMonth)
+		}
+		if change := current.sunset.Sub(previous.sunset).Abs(); change > MAX_MONTHLY_CHANGE {
+			report(month, "sunset changes by %v from month %d", change, previousMonth)
+		}
+	}
+
+	// Report problems by month
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].month < problems[j].month })
+	errs := make([]error, len(problems))
+	for i, problem := range problems {
+		errs[i] = problem.err
+	}
+	return errors.Join(errs...)
+}
+
+// parseSwitchTime parses `str` in the h:mm AM/PM format the switch uses.
+// time.Parse also accepts an hour of 0 or with a leading zero, such as "0:30 AM"
+// or "06:53 AM", which the switch doesn't.
+func parseSwitchTime(str string) (time.Time, error) {
+	if strings.HasPrefix(str, "0") {
+		return time.Time{}, fmt.Errorf("hour in '%s' needs to be from 1 to 12, without a leading zero", str)
+	}
+	return time.Parse(TIME_LAYOUT, str)
+}
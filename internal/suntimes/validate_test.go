@@ -0,0 +1,91 @@
+package suntimes
+
+import (
+	"strings"
+	"testing"
+
+	"indy-mqtt/internal/message"
+)
+
+// validSuntimes returns suntimes for Austin, which pass Validate.
+func validSuntimes() message.Suntimes {
+	return message.Suntimes{
+		1:  {"7:28 AM", "5:53 PM"},
+		2:  {"7:11 AM", "6:19 PM"},
+		3:  {"7:41 AM", "7:39 PM"},
+		4:  {"7:04 AM", "7:58 PM"},
+		5:  {"6:37 AM", "8:18 PM"},
+		6:  {"6:29 AM", "8:34 PM"},
+		7:  {"6:39 AM", "8:34 PM"},
+		8:  {"6:58 AM", "8:13 PM"},
+		9:  {"7:15 AM", "7:37 PM"},
+		10: {"7:33 AM", "7:00 PM"},
+		11: {"6:56 AM", "5:34 PM"},
+		12: {"7:20 AM", "5:32 PM"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(suntimes message.Suntimes)
+		want   []string // Problems expected, in order, or none if valid
+	}{
+		{"valid", func(suntimes message.Suntimes) {}, nil},
+		{"month 13", func(suntimes message.Suntimes) {
+			suntimes[13] = [2]string{"7:00 AM", "6:00 PM"}
+		}, []string{"month 13: not a month from 1 to 12"}},
+		{"missing month", func(suntimes message.Suntimes) {
+			delete(suntimes, 4)
+		}, []string{"month 4: missing"}},
+		{"invalid time", func(suntimes message.Suntimes) {
+			suntimes[2] = [2]string{"25:99 PM", "6:19 PM"}
+		}, []string{"month 2: sunrise '25:99 PM' isn't in the h:mm AM/PM format"}},
+		{"hour 0", func(suntimes message.Suntimes) {
+			suntimes[2] = [2]string{"7:11 AM", "0:30 AM"}
+		}, []string{"month 2: sunset '0:30 AM' isn't in the h:mm AM/PM format"}},
+		{"leading zero", func(suntimes message.Suntimes) {
+			suntimes[2] = [2]string{"07:11 AM", "6:19 PM"}
+		}, []string{"month 2: sunrise '07:11 AM' isn't in the h:mm AM/PM format"}},
+		{"24-hour time", func(suntimes message.Suntimes) {
+			suntimes[2] = [2]string{"7:11 AM", "18:19"}
+		}, []string{"month 2: sunset '18:19' isn't in the h:mm AM/PM format"}},
+		{"sunset before sunrise", func(suntimes message.Suntimes) {
+			suntimes[6] = [2]string{"8:34 PM", "6:29 AM"}
+		}, []string{"month 6: sunrise 8:34 PM isn't before sunset 6:29 AM"}},
+		{"AM/PM swapped between months", func(suntimes message.Suntimes) {
+			suntimes[7] = [2]string{"6:39 AM", "8:34 AM"}
+		}, []string{
+			"month 7: sunset changes by 12h0m0s from month 6",
+			"month 8: sunset changes by 11h39m0s from month 7",
+		}},
+		{"several problems", func(suntimes message.Suntimes) {
+			delete(suntimes, 9)
+			suntimes[3] = [2]string{"7:41", "7:39 PM"}
+			suntimes[0] = [2]string{"7:00 AM", "6:00 PM"}
+		}, []string{
+			"month 0: not a month from 1 to 12",
+			"month 3: sunrise '7:41' isn't in the h:mm AM/PM format",
+			"month 9: missing",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			suntimes := validSuntimes()
+			test.change(suntimes)
+			err := Validate(suntimes)
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate failed: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate succeeded, expected %q", test.want)
+			}
+			if want := strings.Join(test.want, "\n"); err.Error() != want {
+				t.Errorf("got problems:\n%v\nwant:\n%s", err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package timezone
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MIN_NAME_LENGTH is the shortest a POSIX TZ zone name can be.
+const MIN_NAME_LENGTH = 3
+
+// posixParser parses a POSIX TZ string, such as "EST5EDT,M3.2.0,M11.1.0".
+type posixParser struct {
+	str string
+	pos int
+}
+
+// ValidatePOSIX checks that `tz` is a valid POSIX TZ string: a standard time
+// name and offset, optionally followed by a daylight saving time name, offset,
+// and rules for when daylight saving time starts and ends.
+func ValidatePOSIX(tz string) error {
+	parser := &posixParser{str: tz}
+	if err := parser.parse(); err != nil {
+		return fmt.Errorf("invalid POSIX TZ string '%s': %v", tz, err)
+	}
+	return nil
+}
+
+// parse parses the whole string.
+func (parser *posixParser) parse() error {
+	// Standard time
+	if err := parser.name("standard time name"); err != nil {
+		return err
+	}
+	if err := parser.offset("standard time offset", 24); err != nil {
+		return err
+	}
+	if parser.atEnd() {
+		return nil
+	}
+
+	// Daylight saving time
+	if err := parser.name("daylight saving time name"); err != nil {
+		return err
+	}
+	if next := parser.peek(); next == '+' || next == '-' || isDigit(next) {
+		if err := parser.offset("daylight saving time offset", 24); err != nil {
+			return err
+		}
+	}
+	if parser.atEnd() {
+		return nil
+	}
+
+	// Rules
+	for _, what := range []string{"start", "end"} {
+		if !parser.accept(',') {
+			return parser.errorf("expected ',' before the daylight saving time %s rule", what)
+		}
+		if err := parser.date(what + " date"); err != nil {
+			return err
+		}
+		if parser.accept('/') {
+			if err := parser.offset(what+" time", 167); err != nil {
+				return err
+			}
+		}
+	}
+	if !parser.atEnd() {
+		return parser.errorf("unexpected '%s'", parser.str[parser.pos:])
+	}
+	return nil
+}
+
+// name parses a zone name, which is either letters, or letters, digits, and
+// signs in angle brackets.
+func (parser *posixParser) name(what string) error {
+	var name string
+	if parser.accept('<') {
+		end := strings.IndexByte(parser.str[parser.pos:], '>')
+		if end < 0 {
+			return parser.errorf("%s is missing '>'", what)
+		}
+		name = parser.str[parser.pos : parser.pos+end]
+		for _, c := range []byte(name) {
+			if !isLetter(c) && !isDigit(c) && c != '+' && c != '-' {
+				return parser.errorf("%s '%s' has '%c'", what, name, c)
+			}
+		}
+		parser.pos += end + 1
+	} else {
+		start := parser.pos
+		for isLetter(parser.peek()) {
+			parser.pos++
+		}
+		name = parser.str[start:parser.pos]
+	}
+	if len(name) < MIN_NAME_LENGTH {
+		return parser.errorf("expected %s of at least %d letters", what, MIN_NAME_LENGTH)
+	}
+	return nil
+}
+
+// offset parses an offset or time, [+|-]hh[:mm[:ss]], with at most `maxHours`
+// hours.
+func (parser *posixParser) offset(what string, maxHours int) error {
+	if !parser.accept('+') {
+		parser.accept('-')
+	}
+	hours, ok := parser.number(3)
+	if !ok || hours > maxHours {
+		return parser.errorf("expected %s hours from 0 to %d", what, maxHours)
+	}
+	for _, unit := range []string{"minutes", "seconds"} {
+		if !parser.accept(':') {
+			break
+		}
+		value, ok := parser.number(2)
+		if !ok || value > 59 {
+			return parser.errorf("expected %s %s from 00 to 59", what, unit)
+		}
+	}
+	return nil
+}
+
+// date parses a rule date: Jn with the day of the year from 1 to 365 not
+// counting February 29, n with the day of the year from 0 to 365, or Mm.w.d
+// with the month, week of the month from 1 to 5 where 5 is the last, and day
+// of the week from 0 (Sunday) to 6.
+func (parser *posixParser) date(what string) error {
+	switch {
+	case parser.accept('J'):
+		if day, ok := parser.number(3); !ok || day < 1 || day > 365 {
+			return parser.errorf("expected %s Jn with n from 1 to 365", what)
+		}
+	case parser.accept('M'):
+		limits := []struct {
+			name     string
+			min, max int
+		}{{"month", 1, 12}, {"week", 1, 5}, {"weekday", 0, 6}}
+		for i, limit := range limits {
+			if i > 0 && !parser.accept('.') {
+				return parser.errorf("expected %s in the form Mm.w.d", what)
+			}
+			if value, ok := parser.number(2); !ok || value < limit.min || value > limit.max {
+				return parser.errorf("expected %s %s from %d to %d", what, limit.name, limit.min, limit.max)
+			}
+		}
+	default:
+		if day, ok := parser.number(3); !ok || day > 365 {
+			return parser.errorf("expected %s Jn, n, or Mm.w.d", what)
+		}
+	}
+	return nil
+}
+
+// number parses an unsigned number of up to `maxDigits` digits.
+func (parser *posixParser) number(maxDigits int) (int, bool) {
+	start := parser.pos
+	for parser.pos-start < maxDigits && isDigit(parser.peek()) {
+		parser.pos++
+	}
+	value, err := strconv.Atoi(parser.str[start:parser.pos])
+	return value, err == nil
+}
+
+// peek returns the next character, or 0 at the end of the string.
+func (parser *posixParser) peek() byte {
+	if parser.atEnd() {
+		return 0
+	}
+	return parser.str[parser.pos]
+}
+
+// accept consumes the next character if it's `c`, and returns whether it was.
+func (parser *posixParser) accept(c byte) bool {
+	if parser.peek() == c && !parser.atEnd() {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+// atEnd returns whether the whole string has been parsed.
+func (parser *posixParser) atEnd() bool {
+	return parser.pos >= len(parser.str)
+}
+
+// errorf returns an error with the position parsed to.
+func (parser *posixParser) errorf(format string, v ...any) error {
+	return fmt.Errorf("at position %d: %s", parser.pos+1, fmt.Sprintf(format, v...))
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
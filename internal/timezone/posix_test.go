@@ -0,0 +1,47 @@
+package timezone
+
+import "testing"
+
+func TestValidatePOSIX(t *testing.T) {
+	valid := []string{
+		"UTC0",
+		"CST6",
+		"EST5EDT,M3.2.0,M11.1.0",
+		"CET-1CEST,M3.5.0,M10.5.0/3",
+		"NST3:30NDT,M3.2.0,M11.1.0",
+		"<+0545>-5:45",
+		"<-03>3",
+		"<+1245>-12:45<+1345>,M9.5.0/2:45,M4.1.0/3:45",
+		"<-04>4<-03>,M9.1.6/24,M4.1.6/24",
+		"<-02>2<-01>,M3.5.0/-1,M10.5.0/0",
+		"EST5EDT,M3.2.0/25:00,M11.1.0",
+		"EST5EDT,J60,J300",
+		"EST5EDT,59,299",
+	}
+	for _, tz := range valid {
+		if err := ValidatePOSIX(tz); err != nil {
+			t.Errorf("ValidatePOSIX(%q) failed: %v", tz, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"CST",
+		"XY5",
+		"Foo/Bar",
+		"America/Chicago",
+		"EST5EDT,M13.2.0,M11.1.0",
+		"EST5EDT,M3.6.0,M11.1.0",
+		"EST5EDT,M3.2.7,M11.1.0",
+		"EST5EDT,M3.2.0",
+		"EST5EDT,J0,J300",
+		"<+0545-5:45",
+		"EST25",
+		"EST5EDT,M3.2.0,M11.1.0 ",
+	}
+	for _, tz := range invalid {
+		if err := ValidatePOSIX(tz); err == nil {
+			t.Errorf("ValidatePOSIX(%q) succeeded, expected an error", tz)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package indy-mqtt/internal/timezone implements checking the timezones the
+// switch is configured with, which are POSIX TZ strings such as "CST6", and
+// converting IANA timezone names such as "America/Chicago" to them.
+package timezone
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // Embed the timezone database, so IANA names can be converted offline
+)
+
+// RULE_YEARS is how many years, starting with the current year, daylight
+// saving time transitions are checked over to find their rules. Seven years
+// covers every day of the week the first of a month can fall on.
+const RULE_YEARS = 7
+
+// DEFAULT_TRANSITION_TIME is the time of day, in seconds, daylight saving
+// time transitions happen at when a POSIX TZ rule doesn't give a time.
+const DEFAULT_TRANSITION_TIME = 2 * 60 * 60
+
+// SECONDS_PER_DAY is the number of seconds in a day, without transitions.
+const SECONDS_PER_DAY = 24 * 60 * 60
+
+// zone is the zone in effect at some instant.
+type zone struct {
+	name   string
+	offset int // Seconds east of UTC
+	isDST  bool
+}
+
+// zoneAt returns the zone of `location` in effect at Unix time `unix`.
+func zoneAt(location *time.Location, unix int64) zone {
+	t := time.Unix(unix, 0).In(location)
+	name, offset := t.Zone()
+	return zone{name: name, offset: offset, isDST: t.IsDST()}
+}
+
+// transition is a change from one zone to another.
+type transition struct {
+	at          time.Time // Instant of the change, in UTC
+	after       zone
+	month       time.Month // Month, day, and seconds since midnight of the change, in the zone before it
+	day         int
+	secondOfDay int
+}
+
+// Resolve returns the POSIX TZ string for `name`, which can be either a POSIX
+// TZ string, returned as is, or an IANA timezone name, such as
+// "America/New_York", which is converted to a POSIX TZ string, such as
+// "EST5EDT,M3.2.0,M11.1.0".
+func Resolve(name string) (string, error) {
+	return resolveForYear(name, time.Now().Year())
+}
+
+// resolveForYear is Resolve, with the daylight saving time rules in effect
+// from `year` on.
+func resolveForYear(name string, year int) (string, error) {
+	// POSIX TZ string?
+	posixErr := ValidatePOSIX(name)
+	if posixErr == nil {
+		return name, nil
+	}
+
+	// IANA timezone name?
+	if name == "" || name == "Local" {
+		return "", posixErr
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is neither a known IANA timezone nor a POSIX TZ string (%v)", name, posixErr)
+	}
+	return ToPOSIX(location, year)
+}
+
+// ToPOSIX returns the POSIX TZ string for `location`, with the daylight saving
+// time rules in effect from `year` on.
+func ToPOSIX(location *time.Location, year int) (string, error) {
+	// Find transitions
+	var years [][]transition
+	for y := year; y < year+RULE_YEARS; y++ {
+		transitions := findTransitions(location, y)
+		if len(transitions) != 0 && len(transitions) != 2 {
+			return "", fmt.Errorf("timezone %s has %d transitions in %d, instead of a regular daylight saving time rule", location, len(transitions), y)
+		}
+		if len(years) > 0 && len(transitions) != len(years[0]) {
+			return "", fmt.Errorf("timezone %s changes its daylight saving time rules in %d", location, y)
+		}
+		years = append(years, transitions)
+	}
+
+	// No daylight saving time?
+	if len(years[0]) == 0 {
+		standard := zoneAt(location, time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).Unix())
+		return formatName(standard.name) + formatOffset(standard.offset), nil
+	}
+
+	// Which transitions start and end daylight saving time?
+	start, end := 0, 1
+	if !years[0][start].after.isDST {
+		start, end = end, start
+	}
+	standard, daylight := years[0][end].after, years[0][start].after
+	if !daylight.isDST || standard.isDST {
+		return "", fmt.Errorf("timezone %s doesn't alternate between standard and daylight saving time", location)
+	}
+
+	// Create rules
+	startRule, err := transitionRule(location, years, start)
+	if err != nil {
+		return "", err
+	}
+	endRule, err := transitionRule(location, years, end)
+	if err != nil {
+		return "", err
+	}
+	posix := formatName(standard.name) + formatOffset(standard.offset) + formatName(daylight.name)
+	if daylight.offset != standard.offset+60*60 {
+		posix += formatOffset(daylight.offset)
+	}
+	posix += "," + startRule + "," + endRule
+
+	return posix, nil
+}
+
+// findTransitions returns the transitions of `location` during `year`, found
+// by checking the zone each day and then narrowing down to the second.
+func findTransitions(location *time.Location, year int) []transition {
+	var transitions []transition
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	end := time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	previous := zoneAt(location, start)
+	for day := start; day < end; day += SECONDS_PER_DAY {
+		current := zoneAt(location, day+SECONDS_PER_DAY)
+		if current == previous {
+			continue
+		}
+
+		// Narrow down
+		low, high := day, day+SECONDS_PER_DAY
+		for high-low > 1 {
+			middle := (low + high) / 2
+			if zoneAt(location, middle) == previous {
+				low = middle
+			} else {
+				high = middle
+			}
+		}
+		at := time.Unix(high, 0).UTC()
+		local := at.Add(time.Duration(previous.offset) * time.Second)
+		transitions = append(transitions, transition{at: at, after: current, month: local.Month(), day: local.Day(),
+			secondOfDay: local.Hour()*60*60 + local.Minute()*60 + local.Second()})
+		previous = current
+	}
+	return transitions
+}
+
+// transitionRule returns the POSIX TZ rule, Mm.w.d[/time], for transition
+// `index` of each year in `years`, checking that the rule holds for every
+// year. Some rules can only be expressed as the day before or after, with a
+// time past midnight or before it, such as "M3.5.0/-1" for an hour before the
+// last Sunday in March.
+func transitionRule(location *time.Location, years [][]transition, index int) (string, error) {
+	for _, shift := range []int{0, 1, -1} {
+		if rule, ok := shiftedRule(years, index, shift); ok {
+			return rule, nil
+		}
+	}
+	return "", fmt.Errorf("timezone %s has daylight saving time transitions that no POSIX TZ rule describes", location)
+}
+
+// shiftedRule returns the POSIX TZ rule for transition `index` of each year in
+// `years`, with the date shifted by `shift` days and the time of day by the
+// opposite, and whether the rule holds for every year. The week is 5, for the
+// last week of the month, if the transition is in the last week every year.
+func shiftedRule(years [][]transition, index int, shift int) (string, bool) {
+	var rule string
+	weeks := make(map[int]bool)
+	isLast := true
+	for _, transitions := range years {
+		transition := transitions[index]
+		date := time.Date(transition.at.Year(), transition.month, transition.day+shift, 0, 0, 0, 0, time.UTC)
+		if date.Month() != transition.month {
+			return "", false
+		}
+		yearRule := fmt.Sprintf("M%d.%%d.%d", date.Month(), date.Weekday())
+		if secondOfDay := transition.secondOfDay - shift*SECONDS_PER_DAY; secondOfDay != DEFAULT_TRANSITION_TIME {
+			yearRule += "/" + formatSeconds(secondOfDay)
+		}
+		if rule != "" && yearRule != rule {
+			return "", false
+		}
+		rule = yearRule
+		weeks[(date.Day()-1)/7+1] = true
+		daysInMonth := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		if date.Day()+7 <= daysInMonth {
+			isLast = false
+		}
+	}
+
+	// Which week?
+	if isLast {
+		return fmt.Sprintf(rule, 5), true
+	}
+	if len(weeks) != 1 {
+		return "", false
+	}
+	for week := range weeks {
+		rule = fmt.Sprintf(rule, week)
+	}
+	return rule, true
+}
+
+// formatName returns zone name `name` for a POSIX TZ string, in angle brackets
+// unless it's all letters.
+func formatName(name string) string {
+	if len(name) < MIN_NAME_LENGTH {
+		return "<" + name + ">"
+	}
+	for _, c := range []byte(name) {
+		if !isLetter(c) {
+			return "<" + name + ">"
+		}
+	}
+	return name
+}
+
+// formatOffset returns `offset`, in seconds east of UTC, as a POSIX TZ offset,
+// which is the time to add to local time to get UTC. For example, -5 hours is
+// "5", and 5:30 is "-5:30".
+func formatOffset(offset int) string {
+	return formatSeconds(-offset)
+}
+
+// formatSeconds returns `seconds` as [-]h[:mm[:ss]].
+func formatSeconds(seconds int) string {
+	if seconds < 0 {
+		return "-" + formatSeconds(-seconds)
+	}
+	str := fmt.Sprintf("%d", seconds/3600)
+	if seconds%3600 != 0 {
+		str += fmt.Sprintf(":%02d", seconds%3600/60)
+		if seconds%60 != 0 {
+			str += fmt.Sprintf(":%02d", seconds%60)
+		}
+	}
+	return str
+}
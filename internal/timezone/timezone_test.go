@@ -0,0 +1,65 @@
+package timezone
+
+import "testing"
+
+// TEST_YEAR is fixed so that changes to the timezone database's future rules
+// don't depend on when the tests run.
+const TEST_YEAR = 2025
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"EST5EDT,M3.2.0,M11.1.0", "EST5EDT,M3.2.0,M11.1.0"},
+		{"CST6", "CST6"},
+		{"America/New_York", "EST5EDT,M3.2.0,M11.1.0"},
+		{"America/Chicago", "CST6CDT,M3.2.0,M11.1.0"},
+		{"America/Phoenix", "MST7"},
+		{"America/St_Johns", "NST3:30NDT,M3.2.0,M11.1.0"},
+		{"America/Santiago", "<-04>4<-03>,M9.1.6/24,M4.1.6/24"},
+		{"America/Godthab", "<-02>2<-01>,M3.5.0/-1,M10.5.0/0"},
+		{"America/Sao_Paulo", "<-03>3"},
+		{"Europe/Berlin", "CET-1CEST,M3.5.0,M10.5.0/3"},
+		{"Europe/London", "GMT0BST,M3.5.0/1,M10.5.0"},
+		{"Europe/Dublin", "IST-1GMT0,M10.5.0,M3.5.0/1"},
+		{"Asia/Kolkata", "IST-5:30"},
+		{"Asia/Kathmandu", "<+0545>-5:45"},
+		{"Asia/Tehran", "<+0330>-3:30"},
+		{"Australia/Sydney", "AEST-10AEDT,M10.1.0,M4.1.0/3"},
+		{"Australia/Lord_Howe", "<+1030>-10:30<+11>-11,M10.1.0,M4.1.0"},
+		{"Pacific/Auckland", "NZST-12NZDT,M9.5.0,M4.1.0/3"},
+		{"Pacific/Chatham", "<+1245>-12:45<+1345>,M9.5.0/2:45,M4.1.0/3:45"},
+		{"UTC", "UTC0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := resolveForYear(test.name, TEST_YEAR)
+			if err != nil {
+				t.Fatalf("failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if err := ValidatePOSIX(got); err != nil {
+				t.Errorf("result isn't valid: %v", err)
+			}
+		})
+	}
+}
+
+func TestResolveInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"Local",
+		"Foo/Bar",
+		"CST",
+		// Suspends daylight saving time for Ramadan, so has no POSIX rule
+		"Africa/Casablanca",
+	}
+	for _, name := range tests {
+		if got, err := resolveForYear(name, TEST_YEAR); err == nil {
+			t.Errorf("resolveForYear(%q) = %q, expected an error", name, got)
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package util
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -30,6 +31,26 @@ var INFO Logger
 var WARNING Logger
 var ERROR Logger
 
+// Process exit codes. Other errors exit with 1, as log.Fatalf does.
+const (
+	EXIT_OK          = 0   // Success
+	EXIT_USAGE       = 2   // Invalid command line
+	EXIT_CONFIG      = 3   // Config file, or file given on the command line, missing or invalid
+	EXIT_CONNECT     = 4   // Unable to connect to the broker
+	EXIT_PUBLISH     = 5   // Unable to publish the command
+	EXIT_ACK_TIMEOUT = 6   // Timed out waiting for an ACK
+	EXIT_ACK_STATUS  = 7   // ACK returned an error status code
+	EXIT_ACK_HANDLER = 8   // ACK content couldn't be handled
+	EXIT_VERIFY      = 9   // Switch isn't in the state requested
+	EXIT_INTERRUPTED = 130 // Interrupted by a signal
+)
+
+// FatalExitf prints an error message using ERROR and then exits with `code`.
+func FatalExitf(code int, format string, v ...interface{}) {
+	ERROR.Printf(format, v...)
+	os.Exit(code)
+}
+
 // ConfigureLogging configures paho.mqtt logging and creates loggers for local logging.
 func ConfigureLogging() {
 	// Configure paho.mqtt logging
@@ -84,7 +105,26 @@ func capitalizeFirstLetter(input string) string {
 func PrintFatalUsage(message string) {
 	fmt.Fprintf(os.Stderr, "ERROR: %s\n\n", capitalizeFirstLetter(message))
 	flag.Usage()
-	os.Exit(0)
+	os.Exit(EXIT_USAGE)
+}
+
+// InputError is an error in a file or value given on the command line, such as
+// a file that can't be read, as opposed to a usage error.
+type InputError struct {
+	Err error
+}
+
+func (err InputError) Error() string { return err.Err.Error() }
+func (err InputError) Unwrap() error { return err.Err }
+
+// PrintFatalError exits for `err`, an error from parsing the command line: with
+// EXIT_CONFIG if it's an InputError, or with the usage message otherwise.
+func PrintFatalError(err error) {
+	var inputErr InputError
+	if errors.As(err, &inputErr) {
+		FatalExitf(EXIT_CONFIG, "%s", capitalizeFirstLetter(err.Error()))
+	}
+	PrintFatalUsage(err.Error())
 }
 
 // GenerateHexSuffix returns a string of random hex numbers in the form ABCD-0123.
@@ -103,3 +143,31 @@ func GenerateHexSuffix() string {
 		hexDigits[0], hexDigits[1], hexDigits[2], hexDigits[3],
 		hexDigits[4], hexDigits[5], hexDigits[6], hexDigits[7])
 }
+
+// EditDistance returns the Levenshtein distance between `a` and `b`: the
+// number of single-character insertions, deletions, and substitutions needed to
+// turn one into the other.
+func EditDistance(a string, b string) int {
+	runesA := []rune(a)
+	runesB := []rune(b)
+
+	// Compute distances one row at a time
+	prev := make([]int, len(runesB)+1)
+	curr := make([]int, len(runesB)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(runesA); i++ {
+		curr[0] = i
+		for j := 1; j <= len(runesB); j++ {
+			cost := 1
+			if runesA[i-1] == runesB[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(runesB)]
+}